@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/hpb-project/srng-robot/config"
+	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/log"
+	"github.com/hpb-project/srng-robot/services/pullevent"
+	"math/big"
+)
+
+var errStandby = errors.New("this instance is standby, send the request to the leader")
+
+// Status implements controllers.Admin.
+func (r *Robot) Status() map[string]interface{} {
+	syncBlock := new(big.Int)
+	if value, exist, _ := r.ldb.Get([]byte(pullevent.LastSyncBlockKey)); exist {
+		syncBlock.SetBytes(value)
+	}
+	unrevealed, _ := db.GetAllUnReveald(r.ldb)
+	conf := config.Current()
+	return map[string]interface{}{
+		"address":        r.pm.User().Hex(),
+		"revealQueue":    r.pm.RevealQueue(),
+		"pendingTxs":     r.pm.PendingTxs(),
+		"network":        conf.Network,
+		"leader":         r.el.IsLeader(),
+		"nonce":          r.pm.Nonce(),
+		"unrevealed":     len(unrevealed),
+		"lastSyncBlock":  syncBlock.String(),
+		"gasPrice":       conf.GasPrice.String(),
+		"schemaVersion":  db.SchemaVersion(r.ldb),
+		"commitInterval": conf.CommitInterval.String(),
+		"paused":         db.GetPauseState(r.ldb),
+		"lastReconcile":  r.pm.LastReconcile(),
+	}
+}
+
+// ForceReveal implements controllers.Admin.
+func (r *Robot) ForceReveal(commit []byte) error {
+	if !r.el.IsLeader() {
+		return errStandby
+	}
+	return r.pm.ForceReveal(commit)
+}
+
+// Approve implements controllers.Admin.
+func (r *Robot) Approve() error {
+	if !r.el.IsLeader() {
+		return errStandby
+	}
+	return r.pm.Approve()
+}
+
+// SetGasPrice implements controllers.Admin.
+func (r *Robot) SetGasPrice(price *big.Int) error {
+	_, err := config.Apply(func(conf *config.Config) {
+		conf.GasPrice = price
+	})
+	return err
+}
+
+// Pause implements controllers.Admin, the state is kept in the store so it
+// survives restarts and is shared with a standby.
+func (r *Robot) Pause(mode string) error {
+	log.Warn("robot paused", "mode", mode)
+	return db.SetPauseState(r.ldb, mode)
+}
+
+// Replay implements controllers.Admin. Only the leader applies a replay, a
+// standby may dry-run.
+func (r *Robot) Replay(from uint64, to uint64, apply bool) (*pullevent.ReplayResult, error) {
+	if apply && !r.el.IsLeader() {
+		return nil, errStandby
+	}
+	log.Info("replay", "from", from, "to", to, "apply", apply)
+	return r.pe.Replay(context.Background(), from, to, apply)
+}
+
+// Reconcile implements controllers.Admin, only the leader fixes drift.
+func (r *Robot) Reconcile() (*db.ReconcileReport, error) {
+	if !r.el.IsLeader() {
+		return nil, errStandby
+	}
+	return r.pm.Reconcile()
+}
+
+// Resume implements controllers.Admin.
+func (r *Robot) Resume() error {
+	log.Info("robot resumed")
+	return db.SetPauseState(r.ldb, db.PauseNone)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/astaxie/beego"
+	"github.com/hpb-project/srng-robot/config"
+	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/services/stats"
+	"github.com/hpb-project/srng-robot/utils"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// adminClient calls the admin api of a running robot, commands that change
+// the live robot go through it instead of opening the store.
+type adminClient struct {
+	url     string
+	token   string
+	timeout time.Duration
+}
+
+// adminFlags adds the -url and -token flags to fs.
+func adminFlags(fs *flag.FlagSet) *adminClient {
+	c := &adminClient{timeout: time.Second * 30}
+	fs.StringVar(&c.url, "url", "", "admin api url, default http://<httpaddr>:<httpport>")
+	fs.StringVar(&c.token, "token", "", "operator token, minted from jwtSecret when empty")
+	return c
+}
+
+func (c *adminClient) prepare() error {
+	conf, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if c.url == "" {
+		host := beego.BConfig.Listen.HTTPAddr
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "127.0.0.1"
+		}
+		c.url = "http://" + net.JoinHostPort(host, fmt.Sprint(beego.BConfig.Listen.HTTPPort))
+	}
+	if c.token != "" {
+		return nil
+	}
+	if conf.JwtSecret == "" {
+		return fmt.Errorf("no -token given and jwtSecret is not set")
+	}
+	utils.SetJwtSecret(conf.JwtSecret)
+	token, err := utils.CreateToken("cli", utils.GetRandomString(16), utils.RoleOperator, 60)
+	if err != nil {
+		return err
+	}
+	c.token = token
+	return nil
+}
+
+func (c *adminClient) call(method string, path string, form url.Values) (interface{}, error) {
+	if err := c.prepare(); err != nil {
+		return nil, err
+	}
+	target := strings.TrimRight(c.url, "/") + "/robot/admin" + path
+	body := strings.NewReader(form.Encode())
+	if method == http.MethodGet && len(form) > 0 {
+		target += "?" + form.Encode()
+	}
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := (&http.Client{Timeout: c.timeout}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Error  string      `json:"error"`
+		ErrMsg interface{} `json:"err_msg"`
+		Data   interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("bad response %s: %s", resp.Status, data)
+	}
+	if result.Error != "200" {
+		return nil, fmt.Errorf("%v", result.ErrMsg)
+	}
+	return result.Data, nil
+}
+
+func printJSON(v interface{}) {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Println(string(data))
+}
+
+func statusCmd(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	c := adminFlags(fs)
+	fs.Parse(args)
+	data, err := c.call(http.MethodGet, "/status", nil)
+	if err != nil {
+		return err
+	}
+	printJSON(data)
+	return nil
+}
+
+func pauseCmd(args []string) error {
+	fs := flag.NewFlagSet("pause", flag.ExitOnError)
+	c := adminFlags(fs)
+	mode := fs.String("mode", "commits", "commits to stop new commits only, all to stop reveals too")
+	fs.Parse(args)
+	_, err := c.call(http.MethodPost, "/pause", url.Values{"mode": {*mode}})
+	if err == nil {
+		fmt.Println("paused", *mode)
+	}
+	return err
+}
+
+func resumeCmd(args []string) error {
+	fs := flag.NewFlagSet("resume", flag.ExitOnError)
+	c := adminFlags(fs)
+	fs.Parse(args)
+	_, err := c.call(http.MethodPost, "/resume", nil)
+	if err == nil {
+		fmt.Println("resumed")
+	}
+	return err
+}
+
+func reportCmd(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	c := adminFlags(fs)
+	days := fs.Int("days", 30, "number of days to report, today included")
+	format := fs.String("format", "json", "json or csv")
+	fs.Parse(args)
+	data, err := c.call(http.MethodGet, "/report", url.Values{"days": {fmt.Sprint(*days)}})
+	if err != nil {
+		return err
+	}
+	if *format != "csv" {
+		printJSON(data)
+		return nil
+	}
+	var report stats.Report
+	raw, _ := json.Marshal(data)
+	if err := json.Unmarshal(raw, &report); err != nil {
+		return err
+	}
+	return report.WriteCSV(os.Stdout)
+}
+
+func txLogCmd(args []string) error {
+	fs := flag.NewFlagSet("txlog", flag.ExitOnError)
+	c := adminFlags(fs)
+	purpose := fs.String("purpose", "", "approve, commit or reveal")
+	commit := fs.String("commit", "", "only txs of this commit hash")
+	status := fs.String("status", "", "pending, not_sent, success, failed or timeout")
+	since := fs.Int64("since", 0, "only txs signed after this unix time")
+	format := fs.String("format", "json", "json or csv")
+	fs.Parse(args)
+	data, err := c.call(http.MethodGet, "/txs", url.Values{"purpose": {*purpose}, "commit": {*commit},
+		"status": {*status}, "since": {fmt.Sprint(*since)}})
+	if err != nil {
+		return err
+	}
+	if *format != "csv" {
+		printJSON(data)
+		return nil
+	}
+	var list []db.TxRecord
+	raw, _ := json.Marshal(data)
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return err
+	}
+	return db.WriteTxRecordsCSV(os.Stdout, list)
+}
+
+func replayCmd(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	c := adminFlags(fs)
+	from := fs.Uint64("from", 0, "first block to replay")
+	to := fs.Uint64("to", 0, "last block to replay")
+	apply := fs.Bool("apply", false, "write the changes, without it the replay is a dry-run")
+	fs.DurationVar(&c.timeout, "timeout", time.Minute*10, "time to wait for the replay")
+	fs.Parse(args)
+	if *to < *from || *to == 0 {
+		fs.Usage()
+		return fmt.Errorf("-from and -to are required")
+	}
+	method := http.MethodGet
+	if *apply {
+		method = http.MethodPost
+	}
+	data, err := c.call(method, "/replay", url.Values{"from": {fmt.Sprint(*from)}, "to": {fmt.Sprint(*to)}})
+	if err != nil {
+		return err
+	}
+	printJSON(data)
+	return nil
+}
+
+func ledgerCmd(args []string) error {
+	fs := flag.NewFlagSet("ledger", flag.ExitOnError)
+	c := adminFlags(fs)
+	commit := fs.String("commit", "", "only the ledger of this commit hash")
+	format := fs.String("format", "json", "json or csv")
+	fs.Parse(args)
+	data, err := c.call(http.MethodGet, "/ledger", url.Values{"commit": {*commit}})
+	if err != nil {
+		return err
+	}
+	if *format != "csv" {
+		printJSON(data)
+		return nil
+	}
+	var ledger []db.CommitLedger
+	raw, _ := json.Marshal(data)
+	if err := json.Unmarshal(raw, &ledger); err != nil {
+		return err
+	}
+	entries := make([]db.TokenEntry, 0)
+	for _, l := range ledger {
+		entries = append(entries, l.Entries...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Block != entries[j].Block {
+			return entries[i].Block < entries[j].Block
+		}
+		return entries[i].LogIndex < entries[j].LogIndex
+	})
+	return db.WriteTokenEntriesCSV(os.Stdout, entries)
+}
+
+func eventsCmd(args []string) error {
+	fs := flag.NewFlagSet("events", flag.ExitOnError)
+	c := adminFlags(fs)
+	event := fs.String("event", "", "CommitHash, Subscribe, UnSubscribe, RevealSeed or RandomConsumed")
+	committer := fs.String("committer", "", "events of this committer")
+	consumer := fs.String("consumer", "", "events of this consumer")
+	hash := fs.String("hash", "", "events of this commit hash")
+	from := fs.Uint64("from", 0, "first block")
+	to := fs.Uint64("to", 0, "last block")
+	limit := fs.Int("limit", 100, "most events to return")
+	fs.Parse(args)
+	data, err := c.call(http.MethodGet, "/events", url.Values{"event": {*event}, "committer": {*committer},
+		"consumer": {*consumer}, "hash": {*hash}, "from": {fmt.Sprint(*from)}, "to": {fmt.Sprint(*to)},
+		"limit": {fmt.Sprint(*limit)}})
+	if err != nil {
+		return err
+	}
+	printJSON(data)
+	return nil
+}
+
+func reconcileCmd(args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	c := adminFlags(fs)
+	run := fs.Bool("run", false, "reconcile now instead of listing the reports")
+	limit := fs.Int("limit", 20, "most reports to list")
+	fs.Parse(args)
+	method, values := http.MethodGet, url.Values{"limit": {fmt.Sprint(*limit)}}
+	if *run {
+		method, values = http.MethodPost, nil
+	}
+	data, err := c.call(method, "/reconcile", values)
+	if err != nil {
+		return err
+	}
+	printJSON(data)
+	return nil
+}
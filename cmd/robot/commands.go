@@ -0,0 +1,199 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/hpb-project/srng-robot/config"
+	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/services/alert"
+	"github.com/hpb-project/srng-robot/services/apikey"
+	"github.com/hpb-project/srng-robot/utils"
+	"os"
+	"time"
+)
+
+// command is a robot sub command, `robot <name> [flags]`.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{name: "migrate", usage: "run pending db migrations, -dry-run to only report them", run: migrateCmd},
+	{name: "copydb", usage: "copy all data from one db backend to another", run: copyDBCmd},
+	{name: "alert-test", usage: "send a test alert to every configured notifier", run: alertTestCmd},
+	{name: "token", usage: "mint an admin api token, -role read or operator", run: tokenCmd},
+	{name: "status", usage: "show the status of the running robot", run: statusCmd},
+	{name: "pause", usage: "pause the running robot, -mode commits or all", run: pauseCmd},
+	{name: "resume", usage: "resume a paused robot", run: resumeCmd},
+	{name: "request", usage: "request a random value as consumer and wait for it", run: requestCmd},
+	{name: "verify", usage: "verify revealed seeds against their commits, writes a json report", run: verifyCmd},
+	{name: "report", usage: "committer performance report, -days and -format json or csv", run: reportCmd},
+	{name: "txlog", usage: "audit log of signed txs, filter by -purpose -commit -status -since, -format csv", run: txLogCmd},
+	{name: "replay", usage: "run the oracle logs of -from to -to blocks through the handlers again, -apply to write", run: replayCmd},
+	{name: "ledger", usage: "hrg transfers of the committer per commit, -commit, -format json or csv", run: ledgerCmd},
+	{name: "events", usage: "query the oracle-wide event index by -committer -consumer -hash -event -from -to", run: eventsCmd},
+	{name: "reconcile", usage: "reconcile local commits with the oracle, -run now, otherwise list the reports", run: reconcileCmd},
+	{name: "apikey", usage: "manage integrator api keys: create -name, revoke -key, list", run: apiKeyCmd},
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "usage: robot [command] [flags]\n\nwithout command the robot service is started.\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.usage)
+	}
+}
+
+// openDB opens the store of the config file.
+func openDB() (db.Store, error) {
+	conf, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	return db.Open(conf.DBDriver, conf.DBPath)
+}
+
+func migrateCmd(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "run migrations without writing the result")
+	fs.Parse(args)
+
+	ldb, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer ldb.Close()
+	fmt.Printf("schema version %d, latest %d\n", db.SchemaVersion(ldb), db.LatestSchemaVersion())
+	return db.Migrate(ldb, *dryRun)
+}
+
+func copyDBCmd(args []string) error {
+	conf, err := config.Load()
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("copydb", flag.ExitOnError)
+	fromDriver := fs.String("from-driver", conf.DBDriver, "source db driver (leveldb, sqlite, postgres)")
+	from := fs.String("from", conf.DBPath, "source db path or dsn")
+	toDriver := fs.String("to-driver", "", "target db driver (leveldb, sqlite, postgres)")
+	to := fs.String("to", "", "target db path or dsn")
+	fs.Parse(args)
+	if *toDriver == "" || *to == "" {
+		fs.Usage()
+		return fmt.Errorf("target db is required")
+	}
+
+	src, err := db.Open(*fromDriver, *from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := db.Open(*toDriver, *to)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	count, err := db.Copy(src, dst)
+	fmt.Printf("copied %d keys from %s to %s\n", count, *fromDriver, *toDriver)
+	return err
+}
+
+func alertTestCmd(args []string) error {
+	if _, err := config.Load(); err != nil {
+		return err
+	}
+	count, errs := alert.Test()
+	fmt.Printf("sent test alert to %d notifiers, %d failed\n", count, len(errs))
+	for _, err := range errs {
+		fmt.Println(err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("some notifiers failed")
+	}
+	return nil
+}
+
+func tokenCmd(args []string) error {
+	fs := flag.NewFlagSet("token", flag.ExitOnError)
+	user := fs.String("user", "admin", "user the token is issued to")
+	role := fs.String("role", "read", "read or operator")
+	ttl := fs.Duration("ttl", time.Hour*24*30, "token lifetime")
+	fs.Parse(args)
+
+	conf, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if conf.JwtSecret == "" {
+		return fmt.Errorf("jwtSecret is not set in %s", config.ConfigPath())
+	}
+	var authorities string
+	switch *role {
+	case "read":
+		authorities = utils.RoleRead
+	case "operator":
+		authorities = utils.RoleOperator
+	default:
+		return fmt.Errorf("unknown role %s", *role)
+	}
+	utils.SetJwtSecret(conf.JwtSecret)
+	token, err := utils.CreateToken(*user, utils.GetRandomString(16), authorities, int64(ttl.Seconds()))
+	if err != nil {
+		return err
+	}
+	fmt.Println(token)
+	return nil
+}
+
+func apiKeyCmd(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: robot apikey create|revoke|list [flags]")
+	}
+	fs := flag.NewFlagSet("apikey "+args[0], flag.ExitOnError)
+	name := fs.String("name", "", "integrator name, for create")
+	rate := fs.Int("rate", 0, "requests per minute, 0 for apiRateLimit, for create")
+	key := fs.String("key", "", "api key, for revoke")
+	fs.Parse(args[1:])
+
+	ldb, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer ldb.Close()
+
+	switch args[0] {
+	case "create":
+		if *name == "" {
+			return fmt.Errorf("-name is required")
+		}
+		k, err := apikey.Issue(ldb, *name, *rate)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("key:    %s\nsecret: %s\n", k.Key, k.Secret)
+	case "revoke":
+		return apikey.Revoke(ldb, *key)
+	case "list":
+		for _, k := range db.GetAllApiKeys(ldb) {
+			state := "active"
+			if k.Revoked != 0 {
+				state = "revoked at " + time.Unix(k.Revoked, 0).Format(time.RFC3339)
+			}
+			fmt.Printf("%s\t%s\trate %d\t%s\n", k.Key, k.Name, k.RateLimit, state)
+		}
+	default:
+		return fmt.Errorf("unknown apikey action %s", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hpb-project/srng-robot/config"
+	"github.com/hpb-project/srng-robot/consumer"
+	"github.com/hpb-project/srng-robot/utils"
+	"strings"
+	"time"
+)
+
+func requestCmd(args []string) error {
+	conf, err := config.Load()
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("request", flag.ExitOnError)
+	privkey := fs.String("privkey", conf.PrivKey, "consumer private key, default privkey from config")
+	consumerAddr := fs.String("consumer", "", "consumer address, default the key address")
+	token := fs.String("token", "", "hex bytes32 request token, random when empty")
+	hash := fs.String("hash", "", "wait for an existing request matched with this commit")
+	block := fs.Uint64("block", 0, "subscription block of -hash, required with -hash")
+	tx := fs.String("tx", "", "wait for an existing request sent in this requestRandom tx")
+	timeout := fs.Duration("timeout", time.Minute*10, "how long to wait for the reveal")
+	unsubscribe := fs.Bool("unsubscribe", false, "unsubscribe when the reveal times out")
+	fs.Parse(args)
+
+	client, err := consumer.NewClient(conf.NodeRPC, common.HexToAddress(conf.Oracle), *privkey, int64(conf.ChainId))
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	if *hash != "" || *tx != "" {
+		var req *consumer.Request
+		if *tx != "" {
+			req, err = client.Lookup(ctx, common.HexToHash(*tx))
+			if err != nil {
+				return err
+			}
+		} else {
+			if *block == 0 {
+				return errors.New("-hash needs the subscription -block, or use -tx")
+			}
+			req = &consumer.Request{Hash: common.HexToHash(*hash), Block: *block}
+		}
+		waitCtx, cancel := context.WithTimeout(ctx, *timeout)
+		defer cancel()
+		random, err := client.Wait(waitCtx, req)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("random: 0x%s\n", hex.EncodeToString(random[:]))
+		return nil
+	}
+
+	to := client.Address()
+	if *consumerAddr != "" {
+		to = common.HexToAddress(*consumerAddr)
+	}
+	var tok [32]byte
+	if *token != "" {
+		b, err := hex.DecodeString(strings.TrimPrefix(*token, "0x"))
+		if err != nil || len(b) > 32 {
+			return fmt.Errorf("invalid token")
+		}
+		copy(tok[32-len(b):], b)
+	} else {
+		copy(tok[:], utils.CryptoRandom())
+	}
+
+	req, random, err := client.RequestRandom(ctx, to, tok, *timeout, *unsubscribe)
+	if req != nil {
+		fmt.Printf("request tx: %s\ncommit: 0x%s\ncommiter: %s\nblock: %d\n", req.Tx.Hex(),
+			hex.EncodeToString(req.Hash[:]), req.Commiter.Hex(), req.Block)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("random: 0x%s\n", hex.EncodeToString(random[:]))
+	return nil
+}
@@ -1,12 +1,40 @@
 package main
 
 import (
-	"github.com/astaxie/beego/logs"
+	"fmt"
 	"github.com/hpb-project/srng-robot/config"
+	"github.com/hpb-project/srng-robot/log"
+	"os"
 )
 
 func main() {
-	logs.Info("srng robot start")
-	robot := NewRobot(config.GetConfig())
+	if len(os.Args) > 1 {
+		if os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+			printUsage()
+			return
+		}
+		cmd, exist := findCommand(os.Args[1])
+		if !exist {
+			printUsage()
+			os.Exit(2)
+		}
+		if err := cmd.run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s failed: %v\n", cmd.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	conf, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load config failed: %v\n", err)
+		os.Exit(1)
+	}
+	if err := log.Setup(log.Options{Format: conf.LogFormat, File: conf.LogFile,
+		MaxSize: conf.LogMaxSize, MaxBackups: conf.LogMaxBackups}); err != nil {
+		fmt.Fprintf(os.Stderr, "setup log failed: %v\n", err)
+		os.Exit(1)
+	}
+	log.Info("srng robot start")
+	robot := NewRobot(conf)
 	robot.Start()
 }
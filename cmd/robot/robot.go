@@ -2,26 +2,53 @@ package main
 
 import (
 	"fmt"
+	"github.com/astaxie/beego"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/hpb-project/srng-robot/config"
 	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/log"
+	"github.com/hpb-project/srng-robot/routers"
+	"github.com/hpb-project/srng-robot/services/election"
+	"github.com/hpb-project/srng-robot/services/indexer"
 	"github.com/hpb-project/srng-robot/services/monitor"
 	"github.com/hpb-project/srng-robot/services/pullevent"
+	"github.com/hpb-project/srng-robot/services/stats"
+	"github.com/hpb-project/srng-robot/utils"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
 type Robot struct {
-	ldb *db.LevelDB
+	ldb db.Store
 	config config.Config
 
 	pe *pullevent.PullEvent
 	pm *monitor.MonitorService
+	el *election.Election
+	sc *stats.Collector
+
+	stop    chan struct{}
+	elected chan struct{}
+	wg      sync.WaitGroup
 }
 
 func NewRobot(config config.Config) *Robot {
 	robot := new(Robot)
 
-	ldb := db.NewLevelDB(config.DBPath)
-	if ldb == nil {
-		panic("db create failed")
+	// a standby can't open a leveldb store held by the leader, check first.
+	if err := election.CheckMode(config); err != nil {
+		panic(err.Error())
+	}
+	ldb, err := db.Open(config.DBDriver, config.DBPath)
+	if err != nil {
+		panic(fmt.Sprintf("db create failed with error (%s)", err))
+	}
+	if err := db.Migrate(ldb, false); err != nil {
+		panic(fmt.Sprintf("db migrate failed with error (%s)", err))
 	}
 
 	pe := pullevent.NewPullEvent(config, ldb, robot)
@@ -34,10 +61,43 @@ func NewRobot(config config.Config) *Robot {
 		panic(fmt.Sprintf("new monitor service failed with error (%s)",err))
 	}
 
+	el, err := election.NewElection(config, ldb)
+	if err != nil {
+		panic(fmt.Sprintf("new election failed with error (%s)", err))
+	}
+	pm.SetLeaderCheck(el.IsLeader)
+	el.OnChange(func(leader bool) {
+		if leader {
+			pm.ResetNonce()
+		}
+	})
+
+	client, err := ethclient.Dial(config.NodeRPC)
+	if err != nil {
+		panic(fmt.Sprintf("dial node failed with error (%s)", err))
+	}
+	if config.Indexer {
+		if err := indexer.Register(pe.Registry(), common.HexToAddress(config.Oracle), client); err != nil {
+			panic(fmt.Sprintf("register indexer failed with error (%s)", err))
+		}
+	}
+	sc, err := stats.NewCollector(client, config, pm.User(), ldb)
+	if err != nil {
+		panic(fmt.Sprintf("new stats collector failed with error (%s)", err))
+	}
+	sc.SetLeaderCheck(el.IsLeader)
+
+	utils.SetJwtSecret(config.JwtSecret)
+	routers.Init(ldb, robot)
+
 	robot.ldb = ldb
 	robot.config = config
 	robot.pm = pm
 	robot.pe = pe
+	robot.el = el
+	robot.sc = sc
+	robot.stop = make(chan struct{})
+	robot.elected = make(chan struct{})
 
 	return robot
 }
@@ -52,13 +112,53 @@ func (r *Robot) Reveal(commit []byte) error {
 }
 
 func (r *Robot) Start() {
-	go r.pe.GetLogs()
-	go r.pm.Run()
+	go config.Watch(time.Second * 5)
+	go func() {
+		r.el.Run(r.stop)
+		close(r.elected)
+	}()
+	failed := make(chan error, 1)
+	r.run(func() {
+		if err := r.pe.GetLogs(r.stop); err != nil {
+			failed <- err
+		}
+	})
+	r.run(func() { r.pm.Run(r.stop) })
+	r.run(func() { r.sc.Run(r.stop) })
+	if beego.AppConfig.String("httpaddr") == "" {
+		// the admin api stays on this host unless httpaddr says otherwise.
+		beego.BConfig.Listen.HTTPAddr = "127.0.0.1"
+	}
+	go beego.Run()
 
-	run := make(chan struct{})
-	<-run
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-quit:
+		r.Stop()
+	case err := <-failed:
+		// without the events nothing gets revealed, don't commit either.
+		log.Error("event sync can't start, stop the robot", "err", err)
+		r.Stop()
+		os.Exit(1)
+	}
 }
 
-func (r *Robot) Stop() {
+// run starts fn, Stop waits for it before the store is closed.
+func (r *Robot) run(fn func()) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		fn()
+	}()
+}
 
+// Stop resigns leadership so a standby takes over without waiting for the
+// lease to expire, waits for the sync and the monitor to finish their
+// writes, then closes the store.
+func (r *Robot) Stop() {
+	close(r.stop)
+	<-r.elected
+	r.wg.Wait()
+	r.ldb.Close()
 }
\ No newline at end of file
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/hpb-project/srng-robot/config"
+	"github.com/hpb-project/srng-robot/services/verifier"
+	"io/ioutil"
+	"os"
+)
+
+func verifyCmd(args []string) error {
+	conf, err := config.Load()
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	from := fs.Uint64("from", conf.DeployBlock, "first block to scan")
+	to := fs.Uint64("to", 0, "last block to scan, default the chain head")
+	commiter := fs.String("commiter", "", "only verify this committer")
+	out := fs.String("out", "", "write the json report to this file instead of stdout")
+	random := fs.Bool("random", false, "also check getRandom of every revealed commit")
+	step := fs.Uint64("step", 2000, "blocks per log query")
+	fs.Parse(args)
+	if *step < 1 {
+		return errors.New("-step must be at least 1")
+	}
+
+	ctx := context.Background()
+	client, err := ethclient.Dial(conf.NodeRPC)
+	if err != nil {
+		return err
+	}
+	v, err := verifier.NewVerifier(client, common.HexToAddress(conf.Oracle))
+	if err != nil {
+		return err
+	}
+	v.Random = *random
+	v.Step = *step
+	if err := v.Calibrate(ctx); err != nil {
+		return err
+	}
+	if *to == 0 {
+		head, err := client.BlockNumber(ctx)
+		if err != nil {
+			return err
+		}
+		*to = head
+	}
+	var filter *common.Address
+	if *commiter != "" {
+		addr := common.HexToAddress(*commiter)
+		filter = &addr
+	}
+	report, err := v.Scan(ctx, *from, *to, filter)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		fmt.Println(string(data))
+	} else if err := ioutil.WriteFile(*out, data, 0644); err != nil {
+		return err
+	}
+	s := report.Stats
+	fmt.Fprintf(os.Stderr, "commits %d, revealed %d, mismatches %d, random mismatches %d, late %d, unrevealed %d\n",
+		s.Commits, s.Revealed, s.Mismatches, s.RandomMismatches, s.Late, s.Unrevealed)
+	if s.Mismatches > 0 {
+		return fmt.Errorf("found %d seeds that don't match their commit", s.Mismatches)
+	}
+	if s.RandomMismatches > 0 {
+		return fmt.Errorf("found %d randoms that don't follow from their seed", s.RandomMismatches)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// AlertConfig holds alert targets and thresholds, all of it can be changed
+// at runtime.
+type AlertConfig struct {
+	MailHost     string
+	MailPort     int
+	MailUser     string
+	MailPassword string
+	MailTo       string
+
+	Webhook       string
+	SlackWebhook  string
+	TelegramAPI   string
+	TelegramToken string
+	TelegramChat  string
+
+	Dedup     time.Duration // same alert is sent once per window
+	RateLimit int           // max alerts sent per hour
+
+	MinBalance      *big.Int // wei of HPB
+	MinTokenBalance *big.Int // wei of HRG
+	MaxSyncLag      uint64   // blocks behind head
+	RPCFailures     int      // consecutive failed rpc calls
+	NonceStall      time.Duration
+}
+
+var defaultAlertConfig = AlertConfig{
+	MailPort:        25,
+	TelegramAPI:     "https://api.telegram.org",
+	Dedup:           time.Minute * 30,
+	RateLimit:       20,
+	MinBalance:      etherToWei("1"),
+	MinTokenBalance: etherToWei("10"),
+	MaxSyncLag:      100,
+	RPCFailures:     5,
+	NonceStall:      time.Minute * 5,
+}
+
+func etherToWei(value string) *big.Int {
+	d, err := decimal.NewFromString(value)
+	if err != nil {
+		return nil
+	}
+	return d.Shift(18).BigInt()
+}
+
+func getAlertConfig(c appConfig) AlertConfig {
+	conf := defaultAlertConfig
+	conf.MailHost = c.String("alert::mailHost")
+	if v, err := c.Int("alert::mailPort"); err == nil {
+		conf.MailPort = v
+	}
+	conf.MailUser = c.String("alert::mailUser")
+	conf.MailPassword = c.String("alert::mailPassword")
+	conf.MailTo = c.String("alert::mailTo")
+
+	conf.Webhook = c.String("alert::webhook")
+	conf.SlackWebhook = c.String("alert::slackWebhook")
+	conf.TelegramAPI = c.DefaultString("alert::telegramApi", conf.TelegramAPI)
+	conf.TelegramToken = c.String("alert::telegramToken")
+	conf.TelegramChat = c.String("alert::telegramChat")
+
+	if v, err := c.Int("alert::dedup"); err == nil && v >= 0 {
+		conf.Dedup = time.Second * time.Duration(v)
+	}
+	if v, err := c.Int("alert::rateLimit"); err == nil && v > 0 {
+		conf.RateLimit = v
+	}
+	if v := etherToWei(c.String("alert::minBalance")); v != nil {
+		conf.MinBalance = v
+	}
+	if v := etherToWei(c.String("alert::minTokenBalance")); v != nil {
+		conf.MinTokenBalance = v
+	}
+	if v, err := c.Int64("alert::maxSyncLag"); err == nil && v > 0 {
+		conf.MaxSyncLag = uint64(v)
+	}
+	if v, err := c.Int("alert::rpcFailures"); err == nil && v > 0 {
+		conf.RPCFailures = v
+	}
+	if v, err := c.Int("alert::nonceStall"); err == nil && v > 0 {
+		conf.NonceStall = time.Second * time.Duration(v)
+	}
+	return conf
+}
@@ -1,26 +1,227 @@
 package config
 
-import "github.com/astaxie/beego"
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/ethereum/go-ethereum/common"
+)
 
 type Config struct {
-	DBPath  string
-	Oracle  string
-	Token   string
-	NodeRPC string
-	PrivKey string
-	ChainId int
+	DBDriver string
+	DBPath   string
+	Network  string
+	Oracle   string
+	Token    string
+	Deposit  string
+	NodeRPC  string
+	PrivKey  string
+	ChainId  int
+
+	DeployBlock uint64
+	DeployTx    string
+
+	// catch up sync: ranges fetched at once and the largest block range of
+	// one log query.
+	SyncWorkers int
+	SyncRange   uint64
+
+	// Indexer stores the events of all committers, not only ours. Blocks
+	// synced before it was turned on need a replay -apply to be indexed.
+	Indexer bool
+
+	// high availability: none, lease (shared store) or filelock (one host).
+	HAMode     string
+	HANodeId   string
+	HALeaseTTL time.Duration
+	HALockFile string
+
+	// secret signing admin api tokens, the admin api is off without it.
+	JwtSecret string
+	// LegacyApi serves the unsigned /robot/api/getseed of older integrations.
+	LegacyApi bool
+
+	// log output, json or text, to LogFile rotated at LogMaxSize megabytes.
+	LogFormat     string
+	LogFile       string
+	LogMaxSize    int
+	LogMaxBackups int
+
+	// settings below can be changed at runtime, see Reload.
+	CommitInterval    time.Duration
+	RevealInterval    time.Duration
+	GasPrice          *big.Int
+	GasLimit          uint64
+	MaxRevealBacklog  int
+	LogLevel          string
+	ApiRateLimit      int // default requests per minute of an api key
+	StatsInterval     time.Duration
+	StatsRetention    time.Duration // how long snapshots are kept
+	ReconcileInterval time.Duration // how often local commits are checked against the oracle
+	Confirmations     uint64        // blocks on top of a receipt before it counts
+	Alert             AlertConfig
 }
 
 var defaultConfig = Config{
-	DBPath: "./data/application.db",
+	DBDriver: "leveldb",
+	DBPath:   "./data/application.db",
+	Network:  DefaultNetwork,
+
+	HAMode:     "none",
+	HALeaseTTL: time.Second * 15,
+	HALockFile: "./data/robot.lock",
+	LegacyApi:  true,
+
+	LogFormat:     "json",
+	LogMaxSize:    100,
+	LogMaxBackups: 10,
+	SyncWorkers:   4,
+	SyncRange:     5000,
+
+	CommitInterval:    time.Second * 15,
+	RevealInterval:    time.Second * 20,
+	GasPrice:          big.NewInt(5000000000),
+	GasLimit:          1000000,
+	MaxRevealBacklog:  10,
+	LogLevel:          "info",
+	ApiRateLimit:      60,
+	StatsInterval:     time.Minute * 10,
+	StatsRetention:    time.Hour * 24 * 365,
+	ReconcileInterval: time.Minute * 10,
+	Confirmations:     1,
 }
 
-func GetConfig() Config {
+// GetConfig reads the config file beego loaded, it fails on a network
+// without a builtin profile or a section in the file.
+func GetConfig() (Config, error) {
+	return parse(beego.AppConfig)
+}
+
+// parse reads the settings from c and validates them.
+func parse(c appConfig) (Config, error) {
 	conf := defaultConfig
-	conf.NodeRPC = beego.AppConfig.String("url")
-	conf.Oracle = beego.AppConfig.String("oracleAddr")
-	conf.Token = beego.AppConfig.String("tokenAddr")
-	conf.PrivKey = beego.AppConfig.String("privkey")
-	conf.ChainId, _ = beego.AppConfig.Int("chainid")
-	return conf
+	conf.DBDriver = c.DefaultString("dbDriver", conf.DBDriver)
+	conf.DBPath = c.DefaultString("dbPath", conf.DBPath)
+	conf.Network = c.DefaultString("network", conf.Network)
+	network, exist := getNetwork(c, conf.Network)
+	if !exist {
+		return conf, fmt.Errorf("unknown network %s, add a [%s] section or use one of the builtin profiles", conf.Network, conf.Network)
+	}
+	conf.NodeRPC = network.NodeRPC
+	conf.Oracle = network.Oracle
+	conf.Token = network.Token
+	conf.Deposit = network.Deposit
+	conf.ChainId = network.ChainId
+	conf.DeployBlock = network.DeployBlock
+	conf.DeployTx = network.DeployTx
+
+	// top level settings still win over the selected profile.
+	if v := c.String("url"); v != "" {
+		conf.NodeRPC = v
+	}
+	if v := c.String("oracleAddr"); v != "" {
+		conf.Oracle = v
+	}
+	if v := c.String("tokenAddr"); v != "" {
+		conf.Token = v
+	}
+	if v := c.String("depositAddr"); v != "" {
+		conf.Deposit = v
+	}
+	if v, err := c.Int("chainid"); err == nil {
+		conf.ChainId = v
+	}
+	if v, err := c.Int64("deployBlock"); err == nil {
+		conf.DeployBlock = uint64(v)
+	}
+	// profiles like devnet and testnet leave the oracle to the config file.
+	if !common.IsHexAddress(conf.Oracle) || common.HexToAddress(conf.Oracle) == (common.Address{}) {
+		return conf, fmt.Errorf("network %s has no oracle address, set oracleAddr", conf.Network)
+	}
+	conf.PrivKey = c.String("privkey")
+	if v, err := c.Int("syncWorkers"); err == nil && v > 0 {
+		conf.SyncWorkers = v
+	}
+	if v, err := c.Int64("syncRange"); err == nil && v > 0 {
+		conf.SyncRange = uint64(v)
+	}
+	conf.Indexer = c.DefaultBool("indexer", conf.Indexer)
+
+	conf.HAMode = c.DefaultString("haMode", conf.HAMode)
+	conf.HANodeId = c.String("haNodeId")
+	if v, err := c.Int("haLeaseTTL"); err == nil && v > 0 {
+		conf.HALeaseTTL = time.Second * time.Duration(v)
+	}
+	conf.HALockFile = c.DefaultString("haLockFile", conf.HALockFile)
+	conf.JwtSecret = c.String("jwtSecret")
+	conf.LegacyApi = c.DefaultBool("legacyApi", conf.LegacyApi)
+	conf.LogFormat = c.DefaultString("logFormat", conf.LogFormat)
+	conf.LogFile = c.String("logFile")
+	if v, err := c.Int("logMaxSize"); err == nil && v > 0 {
+		conf.LogMaxSize = v
+	}
+	if v, err := c.Int("logMaxBackups"); err == nil && v >= 0 {
+		conf.LogMaxBackups = v
+	}
+
+	if v, err := c.Int("commitInterval"); err == nil && v > 0 {
+		conf.CommitInterval = time.Second * time.Duration(v)
+	}
+	if v, err := c.Int("revealInterval"); err == nil && v > 0 {
+		conf.RevealInterval = time.Second * time.Duration(v)
+	}
+	if s := c.String("gasPrice"); s != "" {
+		v, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return conf, fmt.Errorf("gasPrice %s is not a number", s)
+		}
+		conf.GasPrice = v
+	}
+	if v, err := c.Int64("gasLimit"); err == nil && v > 0 {
+		conf.GasLimit = uint64(v)
+	}
+	if v, err := c.Int("maxRevealBacklog"); err == nil {
+		conf.MaxRevealBacklog = v
+	}
+	conf.LogLevel = c.DefaultString("logLevel", conf.LogLevel)
+	if v, err := c.Int("apiRateLimit"); err == nil && v > 0 {
+		conf.ApiRateLimit = v
+	}
+	if v, err := c.Int64("confirmations"); err == nil && v > 0 {
+		conf.Confirmations = uint64(v)
+	}
+	if v, err := c.Int("statsInterval"); err == nil && v > 0 {
+		conf.StatsInterval = time.Second * time.Duration(v)
+	}
+	if v, err := c.Int("statsRetention"); err == nil && v > 0 {
+		conf.StatsRetention = time.Hour * 24 * time.Duration(v)
+	}
+	if v, err := c.Int("reconcileInterval"); err == nil && v > 0 {
+		conf.ReconcileInterval = time.Second * time.Duration(v)
+	}
+	conf.Alert = getAlertConfig(c)
+	return conf, conf.validate()
+}
+
+// validate checks the runtime settings, a reload or admin change with bad
+// values keeps the running config.
+func (c Config) validate() error {
+	switch {
+	case c.GasPrice == nil || c.GasPrice.Sign() <= 0:
+		return errors.New("gasPrice must be positive")
+	case c.GasLimit == 0:
+		return errors.New("gasLimit must be positive")
+	case c.MaxRevealBacklog <= 0:
+		return errors.New("maxRevealBacklog must be positive")
+	case c.CommitInterval <= 0 || c.RevealInterval <= 0 || c.StatsInterval <= 0 || c.ReconcileInterval <= 0:
+		return errors.New("intervals must be positive")
+	}
+	if _, ok := logLevels[strings.ToLower(c.LogLevel)]; !ok {
+		return fmt.Errorf("unknown logLevel %s", c.LogLevel)
+	}
+	return nil
 }
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"strings"
+)
+
+// Network bundles everything the robot needs to know about one oracle
+// deployment. DeployBlock is where event sync starts on a fresh database;
+// when it is zero the block is looked up from DeployTx instead, the sync
+// doesn't start if the node can't find the tx. Deposit is the contract
+// holding commit deposits, it only labels HRG transfers.
+type Network struct {
+	Name        string
+	NodeRPC     string
+	ChainId     int
+	Oracle      string
+	Token       string
+	Deposit     string
+	DeployBlock uint64
+	DeployTx    string
+}
+
+const DefaultNetwork = "mainnet"
+
+var networks = map[string]Network{
+	"mainnet": {
+		Name:     "mainnet",
+		NodeRPC:  "https://hpbnode.com",
+		ChainId:  269,
+		Oracle:   "0xB2e12D061A4E9d005D4Ae5D5F7Eb9B296570201F",
+		Token:    "0xAf0dB00D59F31C8bD9eEff61F1D26EF82C5cDA15",
+		DeployTx: "0x0cce1507429f709fa77d8e59c795c5e67aa6e7f601f70ad249f97b38f9c681c0",
+	},
+	// testnet deployments move around, oracle and token addresses are
+	// expected to come from the [testnet] section of app.conf.
+	"testnet": {
+		Name: "testnet",
+	},
+	"devnet": {
+		Name:    "devnet",
+		NodeRPC: "http://127.0.0.1:8545",
+		ChainId: 1337,
+	},
+}
+
+// getNetwork returns the profile registered under name. A section with the
+// same name in app.conf overrides the builtin values, and a section for an
+// unknown name defines a custom profile.
+func getNetwork(c appConfig, name string) (Network, bool) {
+	name = strings.ToLower(name)
+	n, exist := networks[name]
+	n.Name = name
+
+	if section, err := c.GetSection(name); err != nil || len(section) == 0 {
+		return n, exist
+	}
+	if v := c.String(name + "::url"); v != "" {
+		n.NodeRPC = v
+	}
+	if v := c.String(name + "::oracleAddr"); v != "" {
+		n.Oracle = v
+	}
+	if v := c.String(name + "::tokenAddr"); v != "" {
+		n.Token = v
+	}
+	if v := c.String(name + "::depositAddr"); v != "" {
+		n.Deposit = v
+	}
+	if v := c.String(name + "::deployTx"); v != "" {
+		n.DeployTx = v
+	}
+	if v, err := c.Int(name + "::chainid"); err == nil {
+		n.ChainId = v
+	}
+	if v, err := c.Int64(name + "::deployBlock"); err == nil {
+		n.DeployBlock = uint64(v)
+	}
+	return n, true
+}
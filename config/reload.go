@@ -0,0 +1,301 @@
+package config
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/astaxie/beego"
+	beegoconfig "github.com/astaxie/beego/config"
+	"github.com/hpb-project/srng-robot/log"
+)
+
+var (
+	current  atomic.Value // Config
+	reloadMu sync.Mutex
+
+	changedMu sync.Mutex
+	changed   = make(chan struct{})
+)
+
+// logLevels maps the level names of the old beego logger to the ones of
+// the structured log.
+var logLevels = map[string]string{
+	"emergency": "crit",
+	"alert":     "crit",
+	"critical":  "crit",
+	"crit":      "crit",
+	"error":     "error",
+	"warn":      "warn",
+	"notice":    "info",
+	"info":      "info",
+	"debug":     "debug",
+	"trace":     "trace",
+}
+
+// appConfig is the part of a parsed config file the settings are read from.
+type appConfig interface {
+	String(key string) string
+	DefaultString(key string, def string) string
+	DefaultBool(key string, def bool) bool
+	Int(key string) (int, error)
+	Int64(key string) (int64, error)
+	GetSection(section string) (map[string]string, error)
+}
+
+// runModeConfig looks a key up in the section of the run mode first, like
+// beego.AppConfig does, for a file parsed apart from it.
+type runModeConfig struct {
+	beegoconfig.Configer
+}
+
+func (c runModeConfig) key(key string) string {
+	if mode := beego.BConfig.RunMode + "::" + key; c.Configer.String(mode) != "" {
+		return mode
+	}
+	return key
+}
+
+func (c runModeConfig) String(key string) string {
+	return c.Configer.String(c.key(key))
+}
+
+func (c runModeConfig) DefaultString(key string, def string) string {
+	return c.Configer.DefaultString(c.key(key), def)
+}
+
+func (c runModeConfig) DefaultBool(key string, def bool) bool {
+	return c.Configer.DefaultBool(c.key(key), def)
+}
+
+func (c runModeConfig) Int(key string) (int, error) {
+	return c.Configer.Int(c.key(key))
+}
+
+func (c runModeConfig) Int64(key string) (int64, error) {
+	return c.Configer.Int64(c.key(key))
+}
+
+// Load reads the config file and makes the result the current config.
+func Load() (Config, error) {
+	conf, err := GetConfig()
+	if err != nil {
+		return conf, err
+	}
+	store(conf)
+	return conf, nil
+}
+
+// store makes conf the current config and wakes up the Changed waiters.
+func store(conf Config) {
+	applyLogLevel(conf.LogLevel)
+	current.Store(conf)
+	changedMu.Lock()
+	close(changed)
+	changed = make(chan struct{})
+	changedMu.Unlock()
+}
+
+// Changed returns a channel that is closed by the next config change. Take
+// it before reading Current, so a change in between isn't missed.
+func Changed() <-chan struct{} {
+	changedMu.Lock()
+	defer changedMu.Unlock()
+	return changed
+}
+
+// Current returns the latest applied config, services read the runtime
+// settings from here on every use so a reload takes effect without restart.
+func Current() Config {
+	if conf, ok := current.Load().(Config); ok {
+		return conf
+	}
+	conf, err := Load()
+	if err != nil {
+		log.Error("load config failed", "err", err)
+	}
+	return conf
+}
+
+// ConfigPath returns the path of the config file beego loaded at startup.
+func ConfigPath() string {
+	if path := os.Getenv("BEEGO_CONFIG_PATH"); path != "" {
+		return path
+	}
+	filename := "app.conf"
+	if mode := os.Getenv("BEEGO_RUNMODE"); mode != "" {
+		filename = mode + ".app.conf"
+	}
+	return filepath.Join(beego.WorkPath, "conf", filename)
+}
+
+// Reload parses the config file again and applies the runtime settings.
+// Changes to settings that need a restart are logged and ignored, a file
+// that doesn't parse or has invalid values leaves the running config and
+// beego.AppConfig as they are.
+func Reload() (Config, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	old := Current()
+	path := ConfigPath()
+	parsed, err := beegoconfig.NewConfig("ini", path)
+	if err != nil {
+		log.Error("reload config failed", "err", err)
+		return old, err
+	}
+	next, err := parse(runModeConfig{parsed})
+	if err != nil {
+		log.Error("reload config failed", "err", err)
+		return old, err
+	}
+	// the file is good, let beego serve it too.
+	if err := beego.LoadAppConfig("ini", path); err != nil {
+		log.Error("reload config failed", "err", err)
+		return old, err
+	}
+	for _, name := range restartOnly(old, next) {
+		log.Warn("config can't change at runtime, keep the running value", "key", name)
+	}
+	conf := applyRuntime(old, next)
+
+	store(conf)
+	log.Info("config reloaded", "commitInterval", conf.CommitInterval, "revealInterval", conf.RevealInterval,
+		"gasPrice", conf.GasPrice, "gasLimit", conf.GasLimit, "maxRevealBacklog", conf.MaxRevealBacklog,
+		"logLevel", conf.LogLevel)
+	return conf, nil
+}
+
+// Apply changes the current config in place, used by the admin api. The
+// change lasts until the next reload from the config file.
+func Apply(fn func(conf *Config)) (Config, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	old := Current()
+	next := old
+	fn(&next)
+	conf := applyRuntime(old, next)
+	if err := conf.validate(); err != nil {
+		return old, err
+	}
+	store(conf)
+	return conf, nil
+}
+
+// applyRuntime returns old with the runtime settings taken from next,
+// everything else keeps the value the robot was started with.
+func applyRuntime(old, next Config) Config {
+	conf := old
+	conf.CommitInterval = next.CommitInterval
+	conf.RevealInterval = next.RevealInterval
+	conf.GasPrice = next.GasPrice
+	conf.GasLimit = next.GasLimit
+	conf.MaxRevealBacklog = next.MaxRevealBacklog
+	conf.LogLevel = next.LogLevel
+	conf.ApiRateLimit = next.ApiRateLimit
+	conf.StatsInterval = next.StatsInterval
+	conf.StatsRetention = next.StatsRetention
+	conf.ReconcileInterval = next.ReconcileInterval
+	conf.Confirmations = next.Confirmations
+	conf.Alert = next.Alert
+	return conf
+}
+
+// restartOnly lists the settings that differ between old and conf but can
+// only be applied by a restart.
+func restartOnly(old, conf Config) []string {
+	changed := make([]string, 0)
+	if old.DBDriver != conf.DBDriver || old.DBPath != conf.DBPath {
+		changed = append(changed, "dbPath")
+	}
+	if old.Network != conf.Network {
+		changed = append(changed, "network")
+	}
+	if old.NodeRPC != conf.NodeRPC {
+		changed = append(changed, "url")
+	}
+	if !strings.EqualFold(old.Oracle, conf.Oracle) {
+		changed = append(changed, "oracleAddr")
+	}
+	if !strings.EqualFold(old.Token, conf.Token) {
+		changed = append(changed, "tokenAddr")
+	}
+	if !strings.EqualFold(old.Deposit, conf.Deposit) {
+		changed = append(changed, "depositAddr")
+	}
+	if old.PrivKey != conf.PrivKey {
+		changed = append(changed, "privkey")
+	}
+	if old.ChainId != conf.ChainId {
+		changed = append(changed, "chainid")
+	}
+	if old.DeployBlock != conf.DeployBlock || old.DeployTx != conf.DeployTx {
+		changed = append(changed, "deployBlock")
+	}
+	if old.SyncWorkers != conf.SyncWorkers || old.SyncRange != conf.SyncRange || old.Indexer != conf.Indexer {
+		changed = append(changed, "sync")
+	}
+	if old.HAMode != conf.HAMode || old.HANodeId != conf.HANodeId ||
+		old.HALeaseTTL != conf.HALeaseTTL || old.HALockFile != conf.HALockFile {
+		changed = append(changed, "ha")
+	}
+	if old.JwtSecret != conf.JwtSecret {
+		changed = append(changed, "jwtSecret")
+	}
+	if old.LegacyApi != conf.LegacyApi {
+		changed = append(changed, "legacyApi")
+	}
+	if old.LogFormat != conf.LogFormat || old.LogFile != conf.LogFile ||
+		old.LogMaxSize != conf.LogMaxSize || old.LogMaxBackups != conf.LogMaxBackups {
+		changed = append(changed, "logFile")
+	}
+	return changed
+}
+
+func applyLogLevel(level string) {
+	l, ok := logLevels[strings.ToLower(level)]
+	if !ok {
+		log.Warn("unknown log level", "level", level)
+		return
+	}
+	log.SetLevel(l)
+}
+
+// Watch reloads the config on SIGHUP and whenever the config file is
+// modified. It blocks, run it in its own goroutine.
+func Watch(interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	path := ConfigPath()
+	var modified time.Time
+	if info, err := os.Stat(path); err == nil {
+		modified = info.ModTime()
+	}
+	for {
+		select {
+		case <-hup:
+			log.Info("got SIGHUP, reload config")
+			Reload()
+
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil || !info.ModTime().After(modified) {
+				continue
+			}
+			modified = info.ModTime()
+			log.Info("config file changed, reload config")
+			Reload()
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/astaxie/beego"
+)
+
+const testConf = `network = devnet
+oracleAddr = 0x1111111111111111111111111111111111111111
+commitInterval = 7
+`
+
+func writeConf(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantErr  bool
+		interval time.Duration
+		raw      string
+	}{
+		{
+			name:     "malformed file",
+			content:  testConf + "commitInterval 9\n",
+			wantErr:  true,
+			interval: 7 * time.Second,
+			raw:      "7",
+		},
+		{
+			name:     "invalid value",
+			content:  "network = devnet\noracleAddr = 0x1111111111111111111111111111111111111111\ncommitInterval = 9\ngasPrice = abc\n",
+			wantErr:  true,
+			interval: 7 * time.Second,
+			raw:      "7",
+		},
+		{
+			name:     "valid change",
+			content:  "network = devnet\noracleAddr = 0x1111111111111111111111111111111111111111\ncommitInterval = 9\n",
+			interval: 9 * time.Second,
+			raw:      "9",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.conf")
+			t.Setenv("BEEGO_CONFIG_PATH", path)
+			writeConf(t, path, testConf)
+			if err := beego.LoadAppConfig("ini", path); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Load(); err != nil {
+				t.Fatal(err)
+			}
+
+			writeConf(t, path, tt.content)
+			conf, err := Reload()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reload error = %v, want error %v", err, tt.wantErr)
+			}
+			if conf.CommitInterval != tt.interval {
+				t.Fatalf("Reload returned commit interval %s, want %s", conf.CommitInterval, tt.interval)
+			}
+			if got := Current().CommitInterval; got != tt.interval {
+				t.Fatalf("current commit interval %s, want %s", got, tt.interval)
+			}
+			if got := beego.AppConfig.String("commitInterval"); got != tt.raw {
+				t.Fatalf("beego serves commitInterval %q, want %q", got, tt.raw)
+			}
+		})
+	}
+}
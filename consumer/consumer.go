@@ -0,0 +1,286 @@
+// Package consumer is the consumer side of the HRG oracle: it requests a
+// random value, waits for a committer to reveal the seed and returns the
+// final random value.
+package consumer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/hpb-project/srng-robot/contracts"
+)
+
+var (
+	ErrNoSubscribe  = errors.New("request receipt has no subscribe event")
+	ErrNoBlock      = errors.New("request has no subscription block")
+	ErrTxFailed     = errors.New("transaction failed")
+	ErrUnsubscribed = errors.New("subscription was cancelled")
+)
+
+// Client talks to the oracle as a consumer.
+type Client struct {
+	client   *ethclient.Client
+	oracle   *contracts.Oracle
+	address  common.Address
+	abi      *abi.ABI
+	key      *ecdsa.PrivateKey
+	user     common.Address
+	chainId  *big.Int
+	interval time.Duration
+}
+
+// Request is a subscribed random request.
+type Request struct {
+	Hash     [32]byte       // commit the request was matched with
+	Commiter common.Address // committer that has to reveal
+	Consumer common.Address
+	Block    uint64 // block of the subscription
+	Tx       common.Hash
+}
+
+func NewClient(rpc string, oracle common.Address, privkey string, chainId int64) (*Client, error) {
+	client, err := ethclient.Dial(rpc)
+	if err != nil {
+		return nil, err
+	}
+	return NewClientWithBackend(client, oracle, privkey, chainId)
+}
+
+func NewClientWithBackend(client *ethclient.Client, oracle common.Address, privkey string, chainId int64) (*Client, error) {
+	key, err := crypto.HexToECDSA(privkey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %v", err)
+	}
+	instance, err := contracts.NewOracle(oracle, client)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := contracts.OracleMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		client:   client,
+		oracle:   instance,
+		address:  oracle,
+		abi:      parsed,
+		key:      key,
+		user:     crypto.PubkeyToAddress(key.PublicKey),
+		chainId:  big.NewInt(chainId),
+		interval: time.Second * 3,
+	}, nil
+}
+
+// Address returns the account the client signs with.
+func (c *Client) Address() common.Address {
+	return c.user
+}
+
+// SetPollInterval changes how often the chain is polled for events.
+func (c *Client) SetPollInterval(d time.Duration) {
+	c.interval = d
+}
+
+func (c *Client) transactOpts(ctx context.Context) (*bind.TransactOpts, error) {
+	opts, err := bind.NewKeyedTransactorWithChainID(c.key, c.chainId)
+	if err != nil {
+		return nil, err
+	}
+	opts.Context = ctx
+	return opts, nil
+}
+
+// Request asks the oracle for a random value for consumer and waits until
+// the request is subscribed to a commit. token is passed through to the
+// oracle to tell requests apart.
+func (c *Client) Request(ctx context.Context, consumer common.Address, token [32]byte) (*Request, error) {
+	opts, err := c.transactOpts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := c.oracle.RequestRandom(opts, c.user, consumer, token)
+	if err != nil {
+		return nil, err
+	}
+	receipt, err := bind.WaitMined(ctx, c.client, tx)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return nil, fmt.Errorf("request random %s: %w", tx.Hash().Hex(), ErrTxFailed)
+	}
+	return c.subscription(receipt)
+}
+
+// Lookup returns the request sent in the requestRandom transaction tx, to
+// wait for a request made elsewhere.
+func (c *Client) Lookup(ctx context.Context, tx common.Hash) (*Request, error) {
+	receipt, err := c.client.TransactionReceipt(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return nil, fmt.Errorf("request random %s: %w", tx.Hex(), ErrTxFailed)
+	}
+	return c.subscription(receipt)
+}
+
+// subscription returns the request of the Subscribe event in receipt.
+func (c *Client) subscription(receipt *types.Receipt) (*Request, error) {
+	subscribe := c.abi.Events["Subscribe"].ID
+	for _, l := range receipt.Logs {
+		if l.Address != c.address || len(l.Topics) == 0 || l.Topics[0] != subscribe {
+			continue
+		}
+		sub, err := c.oracle.ParseSubscribe(*l)
+		if err != nil {
+			return nil, err
+		}
+		return &Request{
+			Hash:     sub.Hash,
+			Commiter: sub.Commiter,
+			Consumer: sub.Consumer,
+			Block:    receipt.BlockNumber.Uint64(),
+			Tx:       receipt.TxHash,
+		}, nil
+	}
+	return nil, ErrNoSubscribe
+}
+
+// Wait polls the oracle logs from the subscription block until the seed of
+// the request is revealed and returns the random value from GetRandom. A
+// request without a block is rejected, it would scan from genesis. When ctx
+// ends the last rpc error, if any, is part of the returned error.
+func (c *Client) Wait(ctx context.Context, req *Request) ([32]byte, error) {
+	var random [32]byte
+	if req.Block == 0 {
+		return random, ErrNoBlock
+	}
+	reveal := c.abi.Events["RevealSeed"].ID
+	consumed := c.abi.Events["RandomConsumed"].ID
+	unsubscribe := c.abi.Events["UnSubscribe"].ID
+
+	from := req.Block
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	var rpcErr error
+	for {
+		head, err := c.client.BlockNumber(ctx)
+		if err != nil {
+			rpcErr = fmt.Errorf("get block number: %v", err)
+		} else if head >= from {
+			logs, err := c.client.FilterLogs(ctx, ethereum.FilterQuery{
+				FromBlock: new(big.Int).SetUint64(from),
+				ToBlock:   new(big.Int).SetUint64(head),
+				Addresses: []common.Address{c.address},
+				Topics:    [][]common.Hash{{reveal, consumed, unsubscribe}},
+			})
+			if err != nil {
+				rpcErr = fmt.Errorf("filter logs %d-%d: %v", from, head, err)
+			} else {
+				rpcErr = nil
+				done, err := c.match(req, logs)
+				if err != nil {
+					return random, err
+				}
+				if done {
+					return c.oracle.GetRandom(&bind.CallOpts{Context: ctx, From: c.user}, req.Hash)
+				}
+				from = head + 1
+			}
+		}
+		select {
+		case <-ctx.Done():
+			if rpcErr != nil {
+				return random, fmt.Errorf("%w, last error: %v", ctx.Err(), rpcErr)
+			}
+			return random, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// match reports whether logs contain the reveal of req.
+func (c *Client) match(req *Request, logs []types.Log) (bool, error) {
+	for _, l := range logs {
+		if len(l.Topics) == 0 {
+			continue
+		}
+		switch l.Topics[0] {
+		case c.abi.Events["RevealSeed"].ID:
+			ev, err := c.oracle.ParseRevealSeed(l)
+			if err == nil && ev.Hash == req.Hash {
+				return true, nil
+			}
+		case c.abi.Events["RandomConsumed"].ID:
+			ev, err := c.oracle.ParseRandomConsumed(l)
+			if err == nil && ev.Hash == req.Hash {
+				return true, nil
+			}
+		case c.abi.Events["UnSubscribe"].ID:
+			ev, err := c.oracle.ParseUnSubscribe(l)
+			if err == nil && ev.Hash == req.Hash {
+				return false, ErrUnsubscribed
+			}
+		}
+	}
+	return false, nil
+}
+
+// Unsubscribe cancels a request that was not revealed.
+func (c *Client) Unsubscribe(ctx context.Context, req *Request) error {
+	opts, err := c.transactOpts(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := c.oracle.UnsubscribeRandom(opts, req.Consumer, req.Hash)
+	if err != nil {
+		return err
+	}
+	receipt, err := bind.WaitMined(ctx, c.client, tx)
+	if err != nil {
+		return err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("unsubscribe %s: %w", tx.Hash().Hex(), ErrTxFailed)
+	}
+	return nil
+}
+
+// RequestRandom requests a random value and waits up to timeout for it.
+// With unsubscribe set a request that timed out is cancelled, so the
+// consumer isn't charged for a value it gave up on.
+func (c *Client) RequestRandom(ctx context.Context, consumer common.Address, token [32]byte, timeout time.Duration, unsubscribe bool) (*Request, [32]byte, error) {
+	var random [32]byte
+	req, err := c.Request(ctx, consumer, token)
+	if err != nil {
+		return nil, random, err
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	random, err = c.Wait(waitCtx, req)
+	if errors.Is(err, context.DeadlineExceeded) && unsubscribe {
+		unsubCtx, unsubCancel := context.WithTimeout(ctx, time.Minute*2)
+		defer unsubCancel()
+		if uerr := c.Unsubscribe(unsubCtx, req); uerr != nil {
+			return req, random, fmt.Errorf("%v, unsubscribe failed: %v", err, uerr)
+		}
+	}
+	return req, random, err
+}
+
+// Subscribed returns the requests of user known to the oracle.
+func (c *Client) Subscribed(ctx context.Context, user common.Address) ([]contracts.Commit, error) {
+	return c.oracle.GetUserSubscribed(&bind.CallOpts{Context: ctx, From: c.user}, user)
+}
@@ -0,0 +1,256 @@
+package controllers
+
+import (
+	"encoding/hex"
+	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/services/apikey"
+	"github.com/hpb-project/srng-robot/services/pullevent"
+	"github.com/hpb-project/srng-robot/services/stats"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+// Admin is the control surface of the running robot.
+type Admin interface {
+	Status() map[string]interface{}
+	ForceReveal(commit []byte) error
+	Approve() error
+	SetGasPrice(price *big.Int) error
+	Pause(mode string) error
+	Resume() error
+	Replay(from uint64, to uint64, apply bool) (*pullevent.ReplayResult, error)
+	Reconcile() (*db.ReconcileReport, error)
+}
+
+type AdminController struct {
+	Controller
+	Admin Admin
+}
+
+func NewAdminController(ldb db.Store, admin Admin) *AdminController {
+	c := &AdminController{}
+	c.Ldb = ldb
+	c.Admin = admin
+	return c
+}
+
+func (d *AdminController) Status() {
+	d.ResponseInfo(200, "ok", d.Admin.Status())
+}
+
+func (d *AdminController) Reveal() {
+	param := strings.TrimPrefix(d.GetString("hash"), "0x")
+	hash, err := hex.DecodeString(param)
+	if err != nil || len(hash) != 32 {
+		d.ResponseInfo(500, "invalid commit hash", nil)
+		return
+	}
+	if err := d.Admin.ForceReveal(hash); err != nil {
+		d.ResponseInfo(500, err.Error(), nil)
+		return
+	}
+	d.ResponseInfo(200, "ok", nil)
+}
+
+func (d *AdminController) Approve() {
+	if err := d.Admin.Approve(); err != nil {
+		d.ResponseInfo(500, err.Error(), nil)
+		return
+	}
+	d.ResponseInfo(200, "ok", nil)
+}
+
+func (d *AdminController) SetGas() {
+	price, ok := new(big.Int).SetString(d.GetString("gasPrice"), 10)
+	if !ok || price.Sign() <= 0 {
+		d.ResponseInfo(500, "invalid gas price", nil)
+		return
+	}
+	if err := d.Admin.SetGasPrice(price); err != nil {
+		d.ResponseInfo(500, err.Error(), nil)
+		return
+	}
+	d.ResponseInfo(200, "ok", price.String())
+}
+
+func (d *AdminController) Pause() {
+	mode := d.GetString("mode", db.PauseCommits)
+	if mode != db.PauseCommits && mode != db.PauseAll {
+		d.ResponseInfo(500, "mode must be commits or all", nil)
+		return
+	}
+	if err := d.Admin.Pause(mode); err != nil {
+		d.ResponseInfo(500, err.Error(), nil)
+		return
+	}
+	d.ResponseInfo(200, "ok", mode)
+}
+
+func (d *AdminController) Resume() {
+	if err := d.Admin.Resume(); err != nil {
+		d.ResponseInfo(500, err.Error(), nil)
+		return
+	}
+	d.ResponseInfo(200, "ok", nil)
+}
+
+func (d *AdminController) ListApiKeys() {
+	keys := db.GetAllApiKeys(d.Ldb)
+	for i := range keys {
+		keys[i].Secret = ""
+	}
+	d.ResponseInfo(200, "ok", keys)
+}
+
+func (d *AdminController) CreateApiKey() {
+	name := d.GetString("name")
+	if name == "" {
+		d.ResponseInfo(500, "name is required", nil)
+		return
+	}
+	rate, _ := d.GetInt("rateLimit", 0)
+	k, err := apikey.Issue(d.Ldb, name, rate)
+	if err != nil {
+		d.ResponseInfo(500, err.Error(), nil)
+		return
+	}
+	d.ResponseInfo(200, "ok", k)
+}
+
+func (d *AdminController) RevokeApiKey() {
+	if err := apikey.Revoke(d.Ldb, d.GetString("key")); err != nil {
+		d.ResponseInfo(500, err.Error(), nil)
+		return
+	}
+	d.ResponseInfo(200, "ok", nil)
+}
+
+// Report returns the committer report of the last days, as json or as csv
+// with format=csv.
+func (d *AdminController) Report() {
+	days, err := d.GetInt("days", 30)
+	if err != nil || days <= 0 {
+		d.ResponseInfo(500, "invalid days", nil)
+		return
+	}
+	from, to := stats.LastDays(days)
+	report := stats.Build(d.Ldb, from, to)
+	if d.GetString("format") == "csv" {
+		d.Ctx.Output.Header("Content-Type", "text/csv")
+		d.Ctx.Output.Header("Content-Disposition", "attachment; filename=report.csv")
+		report.WriteCSV(d.Ctx.ResponseWriter)
+		return
+	}
+	d.ResponseInfo(200, "ok", report)
+}
+
+// Txs returns the tx audit log, filtered by purpose, commit, status and
+// since (unix seconds), as json or as csv with format=csv.
+func (d *AdminController) Txs() {
+	since, err := d.GetInt64("since", 0)
+	if err != nil {
+		d.ResponseInfo(500, "invalid since", nil)
+		return
+	}
+	filter := db.TxFilter{Purpose: d.GetString("purpose"), Commit: d.GetString("commit"),
+		Status: d.GetString("status"), Since: since}
+	list := db.FilterTxRecords(db.GetTxRecords(d.Ldb), filter)
+	if d.GetString("format") == "csv" {
+		d.Ctx.Output.Header("Content-Type", "text/csv")
+		d.Ctx.Output.Header("Content-Disposition", "attachment; filename=txs.csv")
+		db.WriteTxRecordsCSV(d.Ctx.ResponseWriter, list)
+		return
+	}
+	d.ResponseInfo(200, "ok", list)
+}
+
+// Replay runs the oracle logs of [from, to] through the event handlers again,
+// GET is a dry-run and POST writes the changes.
+func (d *AdminController) Replay() {
+	from, err := d.GetUint64("from")
+	if err != nil {
+		d.ResponseInfo(500, "invalid from", nil)
+		return
+	}
+	to, err := d.GetUint64("to")
+	if err != nil {
+		d.ResponseInfo(500, "invalid to", nil)
+		return
+	}
+	result, err := d.Admin.Replay(from, to, d.Ctx.Input.Method() == http.MethodPost)
+	if err != nil {
+		d.ResponseInfo(500, err.Error(), result)
+		return
+	}
+	d.ResponseInfo(200, "ok", result)
+}
+
+// Ledger returns the HRG ledger per commit, commit limits it to one commit
+// and format=csv exports its entries.
+func (d *AdminController) Ledger() {
+	entries := db.GetTokenEntries(d.Ldb)
+	if commit := d.GetString("commit"); commit != "" {
+		list := make([]db.TokenEntry, 0)
+		for _, e := range entries {
+			if strings.EqualFold(e.Commit, commit) {
+				list = append(list, e)
+			}
+		}
+		entries = list
+	}
+	if d.GetString("format") == "csv" {
+		d.Ctx.Output.Header("Content-Type", "text/csv")
+		d.Ctx.Output.Header("Content-Disposition", "attachment; filename=ledger.csv")
+		db.WriteTokenEntriesCSV(d.Ctx.ResponseWriter, entries)
+		return
+	}
+	d.ResponseInfo(200, "ok", db.BuildLedger(entries))
+}
+
+// Events queries the oracle-wide event index by event, committer, consumer,
+// hash and from/to blocks, limit caps the result.
+func (d *AdminController) Events() {
+	from, err := d.GetUint64("from", 0)
+	if err != nil {
+		d.ResponseInfo(500, "invalid from", nil)
+		return
+	}
+	to, err := d.GetUint64("to", 0)
+	if err != nil {
+		d.ResponseInfo(500, "invalid to", nil)
+		return
+	}
+	limit, err := d.GetInt("limit", 100)
+	if err != nil {
+		d.ResponseInfo(500, "invalid limit", nil)
+		return
+	}
+	list, err := db.QueryOracleEvents(d.Ldb, db.EventQuery{Event: d.GetString("event"), Committer: d.GetString("committer"),
+		Consumer: d.GetString("consumer"), Hash: d.GetString("hash"), From: from, To: to, Limit: limit})
+	if err != nil {
+		d.ResponseInfo(500, err.Error(), nil)
+		return
+	}
+	d.ResponseInfo(200, "ok", list)
+}
+
+// Reconcile lists the stored reconcile reports with changes, newest first,
+// POST reconciles the local commits with the oracle now.
+func (d *AdminController) Reconcile() {
+	if d.Ctx.Input.Method() == http.MethodPost {
+		report, err := d.Admin.Reconcile()
+		if err != nil {
+			d.ResponseInfo(500, err.Error(), nil)
+			return
+		}
+		d.ResponseInfo(200, "ok", report)
+		return
+	}
+	limit, err := d.GetInt("limit", 20)
+	if err != nil {
+		d.ResponseInfo(500, "invalid limit", nil)
+		return
+	}
+	d.ResponseInfo(200, "ok", db.GetReconcileReports(d.Ldb, limit))
+}
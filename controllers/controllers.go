@@ -4,16 +4,20 @@ import (
 	"encoding/hex"
 	"github.com/astaxie/beego"
 	"github.com/hpb-project/srng-robot/db"
+	"strconv"
+	"strings"
 )
 
+// Controller fields must be exported, beego copies only exported fields
+// into the controller it creates for each request.
 type Controller struct {
 	beego.Controller
-	ldb *db.LevelDB
+	Ldb db.Store
 }
 
-func NewController(ldb *db.LevelDB) *Controller {
+func NewController(ldb db.Store) *Controller {
 	c := &Controller{}
-	c.ldb = ldb
+	c.Ldb = ldb
 	return c
 }
 
@@ -23,15 +27,37 @@ func (d *Controller) ResponseInfo(code int, errMsg interface{}, result interface
 		d.Data["json"] = map[string]interface{}{"error": "500", "err_msg": errMsg, "data": result}
 	case 200:
 		d.Data["json"] = map[string]interface{}{"error": "200", "err_msg": errMsg, "data": result}
+	default:
+		d.Ctx.Output.SetStatus(code)
+		d.Data["json"] = map[string]interface{}{"error": strconv.Itoa(code), "err_msg": errMsg, "data": result}
 	}
 	d.ServeJSON()
 }
 
 func (d *Controller) GetSeed() {
+	param := d.Ctx.Input.Query("hash")
+	hash,err := hex.DecodeString(strings.TrimPrefix(param, "0x"))
+	if err != nil || len(hash) != 32 {
+		d.ResponseInfo(500, "invalid commit hash", nil)
+		return
+	}
+
+	// never hand out a seed before it is revealed on chain.
+	value,exist := db.GetSeedBySeedHash(d.Ldb, hash)
+	if exist && db.HasRevealedSeed(d.Ldb, hash) {
+		d.ResponseInfo(200, "ok", hex.EncodeToString(value))
+	} else {
+		d.ResponseInfo(500, "not found seed", nil)
+	}
+}
+
+// LegacyGetSeed serves /robot/api/getseed as before the signed api, without
+// auth and for unrevealed commits too.
+func (d *Controller) LegacyGetSeed() {
 	param := d.Ctx.Input.Query("hash")
 	hash,_ := hex.DecodeString(param)
 
-	value,exist := db.GetSeedBySeedHash(d.ldb, hash)
+	value,exist := db.GetSeedBySeedHash(d.Ldb, hash)
 	if exist {
 		d.ResponseInfo(200, "ok", hex.EncodeToString(value))
 	} else {
@@ -39,5 +65,63 @@ func (d *Controller) GetSeed() {
 	}
 }
 
+func (d *Controller) GetCommit() {
+	param := d.Ctx.Input.Query("hash")
+	hash,err := hex.DecodeString(strings.TrimPrefix(param, "0x"))
+	if err != nil || len(hash) != 32 {
+		d.ResponseInfo(500, "invalid commit hash", nil)
+		return
+	}
+	if _, exist := db.GetSeedBySeedHash(d.Ldb, hash); !exist {
+		d.ResponseInfo(500, "not found commit", nil)
+		return
+	}
+	status := "committing"
+	if db.HasRevealedSeed(d.Ldb, hash) {
+		status = "revealed"
+	} else if db.HasUnRevealSeed(d.Ldb, hash) {
+		status = "unrevealed"
+	}
+	result := map[string]interface{}{
+		"hash":   hex.EncodeToString(hash),
+		"status": status,
+	}
+	if tx, exist := db.GetTxBySeedCommit(d.Ldb, hash); exist {
+		result["commitTx"] = hex.EncodeToString(tx)
+	}
+	if tx, exist := db.GetTxBySeedHash(d.Ldb, hash); exist {
+		result["revealTx"] = hex.EncodeToString(tx)
+	}
+	if status == "revealed" {
+		seed, _ := db.GetSeedBySeedHash(d.Ldb, hash)
+		result["seed"] = hex.EncodeToString(seed)
+	}
+	d.ResponseInfo(200, "ok", result)
+}
 
-
+func (d *Controller) GetRevealed() {
+	offset, err := d.GetInt("offset", 0)
+	if err != nil || offset < 0 {
+		d.ResponseInfo(500, "invalid offset", nil)
+		return
+	}
+	limit, err := d.GetInt("limit", 100)
+	if err != nil || limit <= 0 {
+		d.ResponseInfo(500, "invalid limit", nil)
+		return
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+	hashes, total, err := db.GetRevealedPage(d.Ldb, offset, limit)
+	if err != nil {
+		d.ResponseInfo(500, err.Error(), nil)
+		return
+	}
+	list := make([]map[string]string, 0, len(hashes))
+	for _, hash := range hashes {
+		seed, _ := db.GetSeedBySeedHash(d.Ldb, hash)
+		list = append(list, map[string]string{"hash": hex.EncodeToString(hash), "seed": hex.EncodeToString(seed)})
+	}
+	d.ResponseInfo(200, "ok", map[string]interface{}{"total": total, "list": list})
+}
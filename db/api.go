@@ -28,58 +28,109 @@ func keySeedHashRevealed(hash []byte) []byte {
 	return append([]byte(prefixRevealedSeed), hash...)
 }
 
-func SetSeedHashAndSeed(ldb *LevelDB, hash []byte, seed []byte) error {
-	return ldb.Set(keySeedHashAndSeed(hash), seed)
+func SetSeedHashAndSeed(w KeyValueWriter, hash []byte, seed []byte) error {
+	return w.Set(keySeedHashAndSeed(hash), seed)
 }
 
-func GetSeedBySeedHash(ldb *LevelDB, hash []byte) ([]byte, bool) {
-	return ldb.Get(keySeedHashAndSeed(hash))
+func GetSeedBySeedHash(ldb Store, hash []byte) ([]byte, bool) {
+	return get(ldb, keySeedHashAndSeed(hash))
 }
 
-func SetSeedHashAndTx(ldb *LevelDB, hash []byte, tx []byte) error {
-	return ldb.Set(keySeedHashAndTx(hash), tx)
+func SetSeedHashAndTx(w KeyValueWriter, hash []byte, tx []byte) error {
+	return w.Set(keySeedHashAndTx(hash), tx)
 }
 
-func GetTxBySeedHash(ldb *LevelDB, hash []byte) ([]byte, bool) {
-	return ldb.Get(keySeedHashAndTx(hash))
+func GetTxBySeedHash(ldb Store, hash []byte) ([]byte, bool) {
+	return get(ldb, keySeedHashAndTx(hash))
 }
 
-func SetSeedHashAndCommit(ldb *LevelDB, hash []byte, commit []byte) error {
-	return ldb.Set(keySeedHashAndCommit(hash), commit)
+func SetSeedHashAndCommit(w KeyValueWriter, hash []byte, commit []byte) error {
+	return w.Set(keySeedHashAndCommit(hash), commit)
 }
 
-func GetTxBySeedCommit(ldb *LevelDB, hash []byte) ([]byte, bool) {
-	return ldb.Get(keySeedHashAndCommit(hash))
+func GetTxBySeedCommit(ldb Store, hash []byte) ([]byte, bool) {
+	return get(ldb, keySeedHashAndCommit(hash))
 }
 
-func SetRevealedSeed(ldb *LevelDB, hash []byte) error {
-	return ldb.Set(keySeedHashRevealed(hash), hash)
+func SetRevealedSeed(w KeyValueWriter, hash []byte) error {
+	return w.Set(keySeedHashRevealed(hash), hash)
 }
 
-func HasRevealedSeed(ldb *LevelDB, hash []byte) bool {
-	_, exist := ldb.Get(keySeedHashRevealed(hash))
+func HasRevealedSeed(ldb Store, hash []byte) bool {
+	_, exist := get(ldb, keySeedHashRevealed(hash))
 	return exist
 }
 
-func SetUnRevealSeed(ldb *LevelDB, hash []byte) error {
-	return ldb.Set(keySeedHashUnReveal(hash), hash)
+func SetUnRevealSeed(w KeyValueWriter, hash []byte) error {
+	return w.Set(keySeedHashUnReveal(hash), hash)
 }
 
-func HasUnRevealSeed(ldb *LevelDB, hash []byte) bool {
+func HasUnRevealSeed(ldb Store, hash []byte) bool {
 	find, _ := ldb.Has(keySeedHashUnReveal(hash))
 	return find
 }
 
-func DelUnRevealSeed(ldb *LevelDB, hash []byte) {
-	ldb.Del(keySeedHashUnReveal(hash))
+func DelUnRevealSeed(w KeyValueWriter, hash []byte) error {
+	return w.Delete(keySeedHashUnReveal(hash))
 }
 
-func GetAllUnReveald(ldb *LevelDB) [][]byte {
+// SetCommitted records that the commit of hash landed on chain with tx,
+// from now on it waits for reveal.
+func SetCommitted(w KeyValueWriter, hash []byte, tx []byte) error {
+	if err := SetSeedHashAndCommit(w, hash, tx); err != nil {
+		return err
+	}
+	return SetUnRevealSeed(w, hash)
+}
+
+// SetRevealed records that the seed of hash was revealed on chain with tx.
+func SetRevealed(w KeyValueWriter, hash []byte, seed []byte, tx []byte) error {
+	if err := DelUnRevealSeed(w, hash); err != nil {
+		return err
+	}
+	if err := SetSeedHashAndSeed(w, hash, seed); err != nil {
+		return err
+	}
+	if err := SetRevealedSeed(w, hash); err != nil {
+		return err
+	}
+	return SetSeedHashAndTx(w, hash, tx)
+}
+
+// GetAllRevealed returns the hashes of all commits revealed on chain.
+func GetAllRevealed(ldb Store) [][]byte {
 	seedhash := make([][]byte, 0, 1000)
-	ldb.Iterator([]byte(prefixUnrevealedSeed), func(k, v []byte) {
+	ldb.Iterator([]byte(prefixRevealedSeed), func(k, v []byte) {
 		p := make([]byte, len(v))
-		copy(p[:],v[:])
+		copy(p[:], v[:])
 		seedhash = append(seedhash, p)
 	})
 	return seedhash
 }
+
+// GetRevealedPage returns the hashes of up to limit revealed commits after
+// skipping offset of them, and the number of revealed commits.
+func GetRevealedPage(ldb Store, offset int, limit int) ([][]byte, int, error) {
+	seedhash := make([][]byte, 0, limit)
+	total := 0
+	err := ldb.Seek([]byte(prefixRevealedSeed), []byte(prefixRevealedSeed), func(k, v []byte) bool {
+		if total >= offset && len(seedhash) < limit {
+			seedhash = append(seedhash, append([]byte{}, v...))
+		}
+		total++
+		return true
+	})
+	return seedhash, total, err
+}
+
+// GetAllUnReveald returns the commits waiting for reveal, an error means the
+// list is incomplete and must not be taken for the missing ones being done.
+func GetAllUnReveald(ldb Store) ([][]byte, error) {
+	seedhash := make([][]byte, 0, 1000)
+	err := ldb.Iterator([]byte(prefixUnrevealedSeed), func(k, v []byte) {
+		p := make([]byte, len(v))
+		copy(p[:],v[:])
+		seedhash = append(seedhash, p)
+	})
+	return seedhash, err
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"encoding/json"
+)
+
+const prefixApiKey = "kapikey"
+
+// ApiKey is a key issued to a read-only integrator. The secret is kept in
+// clear because requests are verified with an hmac over it.
+type ApiKey struct {
+	Key       string `json:"key"`
+	Secret    string `json:"secret"`
+	Name      string `json:"name"`
+	RateLimit int    `json:"ratelimit"` // requests per minute, 0 for the default
+	Created   int64  `json:"created"`
+	Revoked   int64  `json:"revoked"`
+}
+
+func keyApiKey(key string) []byte {
+	return append([]byte(prefixApiKey), []byte(key)...)
+}
+
+func SetApiKey(w KeyValueWriter, k ApiKey) error {
+	data, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+	return w.Set(keyApiKey(k.Key), data)
+}
+
+func GetApiKey(ldb Store, key string) (ApiKey, bool) {
+	var k ApiKey
+	data, exist := get(ldb, keyApiKey(key))
+	if !exist || json.Unmarshal(data, &k) != nil {
+		return k, false
+	}
+	return k, true
+}
+
+func GetAllApiKeys(ldb Store) []ApiKey {
+	keys := make([]ApiKey, 0)
+	ldb.Iterator([]byte(prefixApiKey), func(k, v []byte) {
+		var key ApiKey
+		if json.Unmarshal(v, &key) == nil {
+			keys = append(keys, key)
+		}
+	})
+	return keys
+}
@@ -0,0 +1,215 @@
+package db
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const prefixTxAudit = "kaudit"
+
+const (
+	AuditSigned    = "signed"
+	AuditBroadcast = "broadcast"
+	AuditReceipt   = "receipt"
+)
+
+const (
+	TxPending = "pending"
+	TxNotSent = "not_sent" // signed but the broadcast failed
+	TxSuccess = "success"
+	TxFailed  = "failed"
+	TxTimeout = "timeout"
+)
+
+// AuditEntry is one step in the life of a signed tx. Entries are only ever
+// appended, the view of a tx is assembled from its entries.
+type AuditEntry struct {
+	Time     int64  `json:"time"`
+	Event    string `json:"event"`
+	TxHash   string `json:"tx"`
+	Purpose  string `json:"purpose,omitempty"`
+	Commit   string `json:"commit,omitempty"`
+	Nonce    uint64 `json:"nonce,omitempty"`
+	GasPrice string `json:"gasPrice,omitempty"`
+	GasLimit uint64 `json:"gasLimit,omitempty"`
+	RawTx    string `json:"rawTx,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Block    uint64 `json:"block,omitempty"`
+	GasUsed  uint64 `json:"gasUsed,omitempty"`
+}
+
+// TxRecord is the audit view of one tx.
+type TxRecord struct {
+	TxHash    string `json:"tx"`
+	Purpose   string `json:"purpose"`
+	Commit    string `json:"commit,omitempty"`
+	Nonce     uint64 `json:"nonce"`
+	GasPrice  string `json:"gasPrice"`
+	GasLimit  uint64 `json:"gasLimit"`
+	RawTx     string `json:"rawTx"`
+	Signed    int64  `json:"signed"`
+	Broadcast string `json:"broadcast"`
+	Status    string `json:"status"`
+	Block     uint64 `json:"block,omitempty"`
+	GasUsed   uint64 `json:"gasUsed,omitempty"`
+	Updated   int64  `json:"updated"`
+}
+
+var (
+	auditLock sync.Mutex
+	auditLast int64
+)
+
+// keyTxAudit orders entries by time, entries written in the same
+// nanosecond get the next free one.
+func keyTxAudit() []byte {
+	auditLock.Lock()
+	now := time.Now().UnixNano()
+	if now <= auditLast {
+		now = auditLast + 1
+	}
+	auditLast = now
+	auditLock.Unlock()
+
+	var t [8]byte
+	binary.BigEndian.PutUint64(t[:], uint64(now))
+	return append([]byte(prefixTxAudit), t[:]...)
+}
+
+func AppendTxAudit(w KeyValueWriter, e AuditEntry) error {
+	if e.Time == 0 {
+		e.Time = time.Now().Unix()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return w.Set(keyTxAudit(), data)
+}
+
+// GetTxAudits returns the entries in the order they were written.
+func GetTxAudits(ldb Store) []AuditEntry {
+	list := make([]AuditEntry, 0)
+	ldb.Iterator([]byte(prefixTxAudit), func(k, v []byte) {
+		var e AuditEntry
+		if json.Unmarshal(v, &e) == nil {
+			list = append(list, e)
+		}
+	})
+	return list
+}
+
+// GetTxAuditsSince returns the entries written at or after the unix time
+// since, only they are read from the store.
+func GetTxAuditsSince(ldb Store, since int64) ([]AuditEntry, error) {
+	var t [8]byte
+	binary.BigEndian.PutUint64(t[:], uint64(time.Unix(since, 0).UnixNano()))
+	list := make([]AuditEntry, 0)
+	err := ldb.Seek([]byte(prefixTxAudit), append([]byte(prefixTxAudit), t[:]...), func(k, v []byte) bool {
+		var e AuditEntry
+		if json.Unmarshal(v, &e) == nil {
+			list = append(list, e)
+		}
+		return true
+	})
+	return list, err
+}
+
+// GetTxRecords folds the audit entries into one record per tx, in the
+// order the txs were signed.
+func GetTxRecords(ldb Store) []TxRecord {
+	return foldTxRecords(GetTxAudits(ldb))
+}
+
+// GetTxRecordsSince folds the entries written since the unix time since, a
+// tx signed before has no signed time and purpose in its record.
+func GetTxRecordsSince(ldb Store, since int64) ([]TxRecord, error) {
+	entries, err := GetTxAuditsSince(ldb, since)
+	if err != nil {
+		return nil, err
+	}
+	return foldTxRecords(entries), nil
+}
+
+func foldTxRecords(entries []AuditEntry) []TxRecord {
+	records := make(map[string]*TxRecord)
+	order := make([]string, 0)
+	for _, e := range entries {
+		r, exist := records[e.TxHash]
+		if !exist {
+			r = &TxRecord{TxHash: e.TxHash, Status: TxPending}
+			records[e.TxHash] = r
+			order = append(order, e.TxHash)
+		}
+		r.Updated = e.Time
+		switch e.Event {
+		case AuditSigned:
+			r.Purpose, r.Commit, r.Nonce = e.Purpose, e.Commit, e.Nonce
+			r.GasPrice, r.GasLimit, r.RawTx, r.Signed = e.GasPrice, e.GasLimit, e.RawTx, e.Time
+		case AuditBroadcast:
+			r.Broadcast = "ok"
+			if e.Error != "" {
+				r.Broadcast = e.Error
+				r.Status = TxNotSent
+			}
+		case AuditReceipt:
+			r.Status, r.Block, r.GasUsed = e.Status, e.Block, e.GasUsed
+		}
+	}
+	list := make([]TxRecord, 0, len(order))
+	for _, h := range order {
+		list = append(list, *records[h])
+	}
+	return list
+}
+
+// TxFilter selects tx records, empty fields match everything.
+type TxFilter struct {
+	Purpose string
+	Commit  string
+	Status  string
+	Since   int64
+}
+
+func (f TxFilter) Match(r TxRecord) bool {
+	if f.Purpose != "" && f.Purpose != r.Purpose {
+		return false
+	}
+	if f.Commit != "" && !strings.EqualFold(f.Commit, r.Commit) {
+		return false
+	}
+	if f.Status != "" && f.Status != r.Status {
+		return false
+	}
+	return r.Signed >= f.Since
+}
+
+func FilterTxRecords(list []TxRecord, f TxFilter) []TxRecord {
+	result := make([]TxRecord, 0)
+	for _, r := range list {
+		if f.Match(r) {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+func WriteTxRecordsCSV(w io.Writer, list []TxRecord) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"tx", "purpose", "commit", "nonce", "gas_price", "gas_limit", "signed", "broadcast",
+		"status", "block", "gas_used", "updated", "raw_tx"})
+	for _, r := range list {
+		cw.Write([]string{r.TxHash, r.Purpose, r.Commit, strconv.FormatUint(r.Nonce, 10), r.GasPrice,
+			strconv.FormatUint(r.GasLimit, 10), strconv.FormatInt(r.Signed, 10), r.Broadcast, r.Status,
+			strconv.FormatUint(r.Block, 10), strconv.FormatUint(r.GasUsed, 10), strconv.FormatInt(r.Updated, 10), r.RawTx})
+	}
+	cw.Flush()
+	return cw.Error()
+}
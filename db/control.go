@@ -0,0 +1,24 @@
+package db
+
+const keyPauseState = "robotPause"
+
+const (
+	PauseNone    = ""
+	PauseCommits = "commits" // no new commits, reveals go on
+	PauseAll     = "all"     // neither commits nor reveals
+)
+
+func SetPauseState(w KeyValueWriter, state string) error {
+	if state == PauseNone {
+		return w.Delete([]byte(keyPauseState))
+	}
+	return w.Set([]byte(keyPauseState), []byte(state))
+}
+
+func GetPauseState(ldb Store) string {
+	value, exist := get(ldb, []byte(keyPauseState))
+	if !exist {
+		return PauseNone
+	}
+	return string(value)
+}
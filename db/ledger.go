@@ -0,0 +1,177 @@
+package db
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+)
+
+const (
+	prefixToken    = "khrg"
+	prefixTxCommit = "ktxcommit"
+)
+
+const (
+	TokenTransfer = "transfer"
+	TokenApproval = "approval"
+)
+
+// kinds of HRG movements, taken from the counterparty of a transfer.
+const (
+	HRGDeposit  = "deposit"  // to the deposit contract
+	HRGRefund   = "refund"   // from the deposit contract
+	HRGFee      = "fee"      // to the oracle
+	HRGReward   = "reward"   // from the oracle
+	HRGIn       = "in"       // from anyone else
+	HRGOut      = "out"      // to anyone else
+	HRGApproval = "approval" // allowance set, nothing moved
+)
+
+// TokenEntry is one HRG Transfer or Approval event involving the committer.
+type TokenEntry struct {
+	Block    uint64 `json:"block"`
+	LogIndex uint   `json:"logIndex"`
+	TxHash   string `json:"tx"`
+	Event    string `json:"event"`
+	Kind     string `json:"kind"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Value    string `json:"value"`
+	Commit   string `json:"commit,omitempty"`
+}
+
+// keyToken orders entries by block and log index.
+func keyToken(block uint64, index uint) []byte {
+	var k [12]byte
+	binary.BigEndian.PutUint64(k[:8], block)
+	binary.BigEndian.PutUint32(k[8:], uint32(index))
+	return append([]byte(prefixToken), k[:]...)
+}
+
+func SetTokenEntry(w KeyValueWriter, e TokenEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return w.Set(keyToken(e.Block, e.LogIndex), data)
+}
+
+// SetTxCommit records that tx emitted an oracle event of commit, token
+// entries of the same tx are booked on it.
+func SetTxCommit(w KeyValueWriter, tx []byte, commit []byte) error {
+	return w.Set(append([]byte(prefixTxCommit), tx...), commit)
+}
+
+func GetTxCommit(ldb Store, tx []byte) ([]byte, bool) {
+	return get(ldb, append([]byte(prefixTxCommit), tx...))
+}
+
+// GetTokenEntries returns the entries in block order with their commit
+// filled in where the tx is known.
+func GetTokenEntries(ldb Store) []TokenEntry {
+	list := make([]TokenEntry, 0)
+	ldb.Iterator([]byte(prefixToken), func(k, v []byte) {
+		var e TokenEntry
+		if json.Unmarshal(v, &e) != nil {
+			return
+		}
+		if tx, err := hex.DecodeString(trim0x(e.TxHash)); err == nil {
+			if commit, exist := GetTxCommit(ldb, tx); exist {
+				e.Commit = "0x" + hex.EncodeToString(commit)
+			}
+		}
+		list = append(list, e)
+	})
+	return list
+}
+
+func trim0x(s string) string {
+	if len(s) >= 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		return s[2:]
+	}
+	return s
+}
+
+// CommitLedger sums the HRG movements booked on one commit, values are in
+// wei and negative when they left the committer. Entries no oracle event
+// could be matched to are booked on an empty commit.
+type CommitLedger struct {
+	Commit  string       `json:"commit"`
+	Deposit string       `json:"deposit"`
+	Refund  string       `json:"refund"`
+	Fee     string       `json:"fee"`
+	Reward  string       `json:"reward"`
+	Other   string       `json:"other"`
+	Net     string       `json:"net"`
+	Entries []TokenEntry `json:"entries"`
+}
+
+// BuildLedger groups entries by commit, commits appear in the order of
+// their first entry and the unbooked entries last.
+func BuildLedger(entries []TokenEntry) []CommitLedger {
+	type sums struct {
+		kinds map[string]*big.Int
+		net   *big.Int
+		list  []TokenEntry
+	}
+	byCommit := make(map[string]*sums)
+	order := make([]string, 0)
+	for _, e := range entries {
+		s, exist := byCommit[e.Commit]
+		if !exist {
+			s = &sums{kinds: make(map[string]*big.Int), net: new(big.Int)}
+			byCommit[e.Commit] = s
+			order = append(order, e.Commit)
+		}
+		s.list = append(s.list, e)
+		value, ok := new(big.Int).SetString(e.Value, 10)
+		if !ok || e.Event != TokenTransfer {
+			continue
+		}
+		kind := e.Kind
+		if kind == HRGIn || kind == HRGOut {
+			kind = "other"
+		}
+		if s.kinds[kind] == nil {
+			s.kinds[kind] = new(big.Int)
+		}
+		switch e.Kind {
+		case HRGDeposit, HRGFee, HRGOut:
+			s.kinds[kind].Sub(s.kinds[kind], value)
+			s.net.Sub(s.net, value)
+		default:
+			s.kinds[kind].Add(s.kinds[kind], value)
+			s.net.Add(s.net, value)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return order[i] != "" && order[j] == "" })
+	ledger := make([]CommitLedger, 0, len(order))
+	for _, c := range order {
+		s := byCommit[c]
+		total := func(kind string) string {
+			if v := s.kinds[kind]; v != nil {
+				return v.String()
+			}
+			return "0"
+		}
+		ledger = append(ledger, CommitLedger{Commit: c, Deposit: total(HRGDeposit), Refund: total(HRGRefund),
+			Fee: total(HRGFee), Reward: total(HRGReward), Other: total("other"), Net: s.net.String(), Entries: s.list})
+	}
+	return ledger
+}
+
+func WriteTokenEntriesCSV(w io.Writer, list []TokenEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"block", "log_index", "tx", "event", "kind", "from", "to", "value", "commit"})
+	for _, e := range list {
+		cw.Write([]string{strconv.FormatUint(e.Block, 10), strconv.FormatUint(uint64(e.LogIndex), 10), e.TxHash,
+			e.Event, e.Kind, e.From, e.To, e.Value, e.Commit})
+	}
+	cw.Flush()
+	return cw.Error()
+}
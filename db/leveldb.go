@@ -1,7 +1,8 @@
 package db
 
 import (
-	"github.com/astaxie/beego/logs"
+	"bytes"
+	"github.com/hpb-project/srng-robot/log"
 	"sync"
 	"time"
 
@@ -63,13 +64,15 @@ type LevelDB struct {
 
 	quitLock sync.Mutex      // Mutex protecting the quit channel access
 	quitChan chan chan error // Quit channel to stop the metrics collection before closing the database
+
+	casLock sync.Mutex // Mutex serializing compare and swap
 }
 
 func NewLevelDB(path string) *LevelDB {
 	file, cache, handles := path, 1000, 1000
 	db, err := New(file, cache, handles)
 	if err != nil {
-		logs.Error(" new level db failed ", " error ", err)
+		log.Error("new level db failed", "err", err)
 		return nil
 	}
 	return db
@@ -103,7 +106,7 @@ func NewCustom(file string, customize func(options *opt.Options)) (*LevelDB, err
 	if options.ReadOnly {
 		logCtx = append(logCtx, "readonly", "true")
 	}
-	logs.Info("Allocated cache and file handles ", "logCtx ", logCtx)
+	log.Info("Allocated cache and file handles", logCtx...)
 
 	// Open the db and recover any potential corruptions
 	db, err := leveldb.OpenFile(file, options)
@@ -114,10 +117,11 @@ func NewCustom(file string, customize func(options *opt.Options)) (*LevelDB, err
 		return nil, err
 	}
 	// Assemble the wrapper with all the registered metrics
+	// no metrics collection runs yet, leave quitChan nil so Close
+	// doesn't wait for it.
 	ldb := &LevelDB{
-		fn:       file,
-		db:       db,
-		quitChan: make(chan chan error),
+		fn: file,
+		db: db,
 	}
 
 	return ldb, nil
@@ -147,7 +151,7 @@ func (db *LevelDB) Close() error {
 		errc := make(chan error)
 		db.quitChan <- errc
 		if err := <-errc; err != nil {
-			logs.Error("Metrics collection failed", "err", err)
+			log.Error("Metrics collection failed", "err", err)
 		}
 		db.quitChan = nil
 	}
@@ -161,13 +165,17 @@ func (db *LevelDB) Has(key interface{}) (bool, error) {
 }
 
 // Get retrieves the given key if it's present in the key-value store.
-func (db *LevelDB) Get(key interface{}) ([]byte, bool) {
+func (db *LevelDB) Get(key interface{}) ([]byte, bool, error) {
 	k := key.([]byte)
 	dat, err := db.db.Get(k, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, false, nil
+	}
 	if err != nil {
-		return nil, false
+		log.Error("leveldb get failed", "err", err)
+		return nil, false, err
 	}
-	return dat, true
+	return dat, true, nil
 }
 
 // Put inserts the given value into the key-value store.
@@ -182,7 +190,43 @@ func (db *LevelDB) Del(key interface{}) error {
 	return db.db.Delete(k, nil)
 }
 
-func (db *LevelDB) Iterator(prefix []byte, iterfunc func(key, value []byte)) {
+// Delete removes the key from the key-value store, it makes LevelDB a
+// KeyValueWriter so the same helpers write either directly or into a batch.
+func (db *LevelDB) Delete(key interface{}) error {
+	return db.Del(key)
+}
+
+// Update runs fn with a new batch and writes the batch only if fn succeeds,
+// all changes queued by fn are applied atomically.
+func (db *LevelDB) Update(fn func(b Batch) error) error {
+	b := db.NewBatch()
+	if err := fn(b); err != nil {
+		return err
+	}
+	return b.Write()
+}
+
+// CompareAndSwap sets key to value if its current value equals old. leveldb
+// is opened by a single process, so a mutex is enough to make it atomic.
+func (db *LevelDB) CompareAndSwap(key interface{}, old []byte, value []byte) (bool, error) {
+	db.casLock.Lock()
+	defer db.casLock.Unlock()
+
+	k := key.([]byte)
+	cur, err := db.db.Get(k, nil)
+	if err == leveldb.ErrNotFound {
+		if old != nil {
+			return false, nil
+		}
+	} else if err != nil {
+		return false, err
+	} else if old == nil || !bytes.Equal(cur, old) {
+		return false, nil
+	}
+	return true, db.db.Put(k, value, nil)
+}
+
+func (db *LevelDB) Iterator(prefix []byte, iterfunc func(key, value []byte)) error {
 	iter := db.db.NewIterator(util.BytesPrefix(prefix), nil)
 	defer iter.Release()
 	for iter.Next() {
@@ -194,6 +238,26 @@ func (db *LevelDB) Iterator(prefix []byte, iterfunc func(key, value []byte)) {
 			iterfunc(key, value)
 		}
 	}
+	return iterError(iter.Error())
+}
+
+func (db *LevelDB) Seek(prefix []byte, start []byte, fn func(key, value []byte) bool) error {
+	r := util.BytesPrefix(prefix)
+	if bytes.Compare(start, r.Start) > 0 {
+		r.Start = start
+	}
+	iter := db.db.NewIterator(r, nil)
+	defer iter.Release()
+	for iter.Next() && fn(iter.Key(), iter.Value()) {
+	}
+	return iterError(iter.Error())
+}
+
+func iterError(err error) error {
+	if err != nil {
+		log.Error("leveldb iterate failed", "err", err)
+	}
+	return err
 }
 
 // NewBatch creates a write-only key-value store that buffers changes to its host
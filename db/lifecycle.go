@@ -0,0 +1,252 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+)
+
+// every stage of a commit is kept under its own key, so stages seen in the
+// same synced block range can be written into one batch without reading
+// each other back.
+const (
+	prefixLifeCommit    = "klcommit"
+	prefixLifeSubscribe = "klsub"
+	prefixLifeReveal    = "klreveal"
+	prefixLifeExpired   = "klexpired"
+	prefixLifeUnsub     = "klunsub"
+	prefixLifeConsumed  = "klconsumed"
+	prefixLifeFee       = "klfee"
+	prefixLifeError     = "klerror"
+	prefixSnapshot      = "ksnapshot"
+)
+
+const (
+	FeeCommit = "commit"
+	FeeReveal = "reveal"
+)
+
+// Lifecycle is what we know locally about one of our commits.
+type Lifecycle struct {
+	Hash          string `json:"hash"`
+	CommitBlock   uint64 `json:"commitBlock"`
+	CommitTime    uint64 `json:"commitTime"`
+	CommitTx      string `json:"commitTx"`
+	CommitFee     string `json:"commitFee,omitempty"`
+	Consumer      string `json:"consumer,omitempty"`
+	SubBlock      uint64 `json:"subscribeBlock,omitempty"`
+	SubTime       uint64 `json:"subscribeTime,omitempty"`
+	RevealBlock   uint64 `json:"revealBlock,omitempty"`
+	RevealTime    uint64 `json:"revealTime,omitempty"`
+	RevealTx      string `json:"revealTx,omitempty"`
+	RevealFee     string `json:"revealFee,omitempty"`
+	ExpiredBlock  uint64 `json:"expiredBlock,omitempty"`
+	UnsubBlock    uint64 `json:"unsubscribeBlock,omitempty"`
+	ConsumedBlock uint64 `json:"consumedBlock,omitempty"`
+	CommitError   string `json:"commitError,omitempty"`
+	RevealError   string `json:"revealError,omitempty"`
+}
+
+type lifeStage struct {
+	Block    uint64 `json:"block"`
+	Time     uint64 `json:"time,omitempty"`
+	Tx       string `json:"tx,omitempty"`
+	Consumer string `json:"consumer,omitempty"`
+}
+
+func keyLife(prefix string, hash []byte) []byte {
+	return append([]byte(prefix), hash...)
+}
+
+func setLifeStage(w KeyValueWriter, prefix string, hash []byte, stage lifeStage) error {
+	data, err := json.Marshal(stage)
+	if err != nil {
+		return err
+	}
+	return w.Set(keyLife(prefix, hash), data)
+}
+
+func getLifeStage(ldb Store, prefix string, hash []byte) (lifeStage, bool) {
+	var stage lifeStage
+	data, exist := get(ldb, keyLife(prefix, hash))
+	if !exist || json.Unmarshal(data, &stage) != nil {
+		return stage, false
+	}
+	return stage, true
+}
+
+func SetLifeCommit(w KeyValueWriter, hash []byte, block uint64, time uint64, tx []byte) error {
+	return setLifeStage(w, prefixLifeCommit, hash, lifeStage{Block: block, Time: time, Tx: "0x" + hex.EncodeToString(tx)})
+}
+
+func SetLifeSubscribe(w KeyValueWriter, hash []byte, consumer string, block uint64, time uint64) error {
+	return setLifeStage(w, prefixLifeSubscribe, hash, lifeStage{Block: block, Time: time, Consumer: consumer})
+}
+
+func SetLifeReveal(w KeyValueWriter, hash []byte, block uint64, time uint64, tx []byte) error {
+	return setLifeStage(w, prefixLifeReveal, hash, lifeStage{Block: block, Time: time, Tx: "0x" + hex.EncodeToString(tx)})
+}
+
+func SetLifeExpired(w KeyValueWriter, hash []byte, block uint64) error {
+	return setLifeStage(w, prefixLifeExpired, hash, lifeStage{Block: block})
+}
+
+func SetLifeUnsubscribe(w KeyValueWriter, hash []byte, block uint64, time uint64) error {
+	return setLifeStage(w, prefixLifeUnsub, hash, lifeStage{Block: block, Time: time})
+}
+
+func SetLifeConsumed(w KeyValueWriter, hash []byte, block uint64, time uint64) error {
+	return setLifeStage(w, prefixLifeConsumed, hash, lifeStage{Block: block, Time: time})
+}
+
+// SetLifeFee records the HPB paid in gas for the commit or reveal of hash.
+func SetLifeFee(w KeyValueWriter, hash []byte, purpose string, fee *big.Int) error {
+	return w.Set(append(keyLife(prefixLifeFee, hash), []byte(purpose)...), fee.Bytes())
+}
+
+// SetLifeError records why the commit or reveal of hash reverted.
+func SetLifeError(w KeyValueWriter, hash []byte, purpose string, reason string) error {
+	return w.Set(append(keyLife(prefixLifeError, hash), []byte(purpose)...), []byte(reason))
+}
+
+func getLifeError(ldb Store, hash []byte, purpose string) string {
+	value, _ := get(ldb, append(keyLife(prefixLifeError, hash), []byte(purpose)...))
+	return string(value)
+}
+
+func getLifeFee(ldb Store, hash []byte, purpose string) string {
+	value, exist := get(ldb, append(keyLife(prefixLifeFee, hash), []byte(purpose)...))
+	if !exist {
+		return ""
+	}
+	return new(big.Int).SetBytes(value).String()
+}
+
+// GetLifecycle assembles the stages of a commit, false if the commit was
+// never seen on chain.
+func GetLifecycle(ldb Store, hash []byte) (Lifecycle, bool) {
+	l := Lifecycle{Hash: "0x" + hex.EncodeToString(hash)}
+	commit, exist := getLifeStage(ldb, prefixLifeCommit, hash)
+	if !exist {
+		return l, false
+	}
+	l.CommitBlock, l.CommitTime, l.CommitTx = commit.Block, commit.Time, commit.Tx
+	l.CommitFee = getLifeFee(ldb, hash, FeeCommit)
+	l.CommitError = getLifeError(ldb, hash, FeeCommit)
+	l.RevealError = getLifeError(ldb, hash, FeeReveal)
+	if sub, exist := getLifeStage(ldb, prefixLifeSubscribe, hash); exist {
+		l.Consumer, l.SubBlock, l.SubTime = sub.Consumer, sub.Block, sub.Time
+	}
+	if reveal, exist := getLifeStage(ldb, prefixLifeReveal, hash); exist {
+		l.RevealBlock, l.RevealTime, l.RevealTx = reveal.Block, reveal.Time, reveal.Tx
+		l.RevealFee = getLifeFee(ldb, hash, FeeReveal)
+	}
+	if expired, exist := getLifeStage(ldb, prefixLifeExpired, hash); exist {
+		l.ExpiredBlock = expired.Block
+	}
+	if unsub, exist := getLifeStage(ldb, prefixLifeUnsub, hash); exist {
+		l.UnsubBlock = unsub.Block
+	}
+	if consumed, exist := getLifeStage(ldb, prefixLifeConsumed, hash); exist {
+		l.ConsumedBlock = consumed.Block
+	}
+	return l, true
+}
+
+// GetAllLifecycles returns the lifecycle of every commit seen on chain.
+func GetAllLifecycles(ldb Store) []Lifecycle {
+	hashes := make([][]byte, 0)
+	ldb.Iterator([]byte(prefixLifeCommit), func(k, v []byte) {
+		hash := make([]byte, len(k)-len(prefixLifeCommit))
+		copy(hash, k[len(prefixLifeCommit):])
+		hashes = append(hashes, hash)
+	})
+	list := make([]Lifecycle, 0, len(hashes))
+	for _, hash := range hashes {
+		if l, exist := GetLifecycle(ldb, hash); exist {
+			list = append(list, l)
+		}
+	}
+	return list
+}
+
+// CountConsumed returns how many of our commits had their random consumed,
+// the oracle only counts consumption per consumer.
+func CountConsumed(ldb Store) (int, error) {
+	count := 0
+	err := ldb.Iterator([]byte(prefixLifeConsumed), func(k, v []byte) {
+		count++
+	})
+	return count, err
+}
+
+// Snapshot is a periodic sample of the oracle statistics and our balances,
+// ConsumedCount is counted from the local lifecycles.
+type Snapshot struct {
+	Time          int64     `json:"time"`
+	Block         uint64    `json:"block"`
+	ValidCount    string    `json:"validCount"`
+	ConsumedCount string    `json:"consumedCount"`
+	TotalStat     [3]string `json:"totalStat"`
+	Commits       int       `json:"commits"`
+	Unverified    int       `json:"unverified"`
+	HPBBalance    string    `json:"hpbBalance"`
+	HRGBalance    string    `json:"hrgBalance"`
+}
+
+func keySnapshot(time int64) []byte {
+	var t [8]byte
+	binary.BigEndian.PutUint64(t[:], uint64(time))
+	return append([]byte(prefixSnapshot), t[:]...)
+}
+
+func SetSnapshot(w KeyValueWriter, s Snapshot) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return w.Set(keySnapshot(s.Time), data)
+}
+
+// PruneSnapshots deletes the snapshots taken before the unix time before and
+// returns how many were deleted.
+func PruneSnapshots(ldb Store, before int64) (int, error) {
+	end := keySnapshot(before)
+	keys := make([][]byte, 0)
+	err := ldb.Seek([]byte(prefixSnapshot), []byte(prefixSnapshot), func(k, v []byte) bool {
+		if bytes.Compare(k, end) >= 0 {
+			return false
+		}
+		keys = append(keys, append([]byte{}, k...))
+		return true
+	})
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+	err = ldb.Update(func(b Batch) error {
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// GetSnapshots returns the snapshots in time order.
+func GetSnapshots(ldb Store) []Snapshot {
+	list := make([]Snapshot, 0)
+	ldb.Iterator([]byte(prefixSnapshot), func(k, v []byte) {
+		var s Snapshot
+		if json.Unmarshal(v, &s) == nil {
+			list = append(list, s)
+		}
+	})
+	return list
+}
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// the oracle-wide index: events by position and secondary keys that end
+// with and hold the position of the event.
+const (
+	prefixIndexEvent     = "kiev"
+	prefixIndexCommitter = "kicm"
+	prefixIndexConsumer  = "kicn"
+	prefixIndexHash      = "kihs"
+)
+
+// MaxIndexQuery caps the events a query returns and the blocks a query
+// without committer, consumer or hash may span.
+const MaxIndexQuery = 1000
+
+// OracleEvent is an oracle event of any committer.
+type OracleEvent struct {
+	Event     string `json:"event"`
+	Block     uint64 `json:"block"`
+	LogIndex  uint   `json:"logIndex"`
+	TxHash    string `json:"tx"`
+	Hash      string `json:"hash"`
+	Committer string `json:"committer"`
+	Consumer  string `json:"consumer,omitempty"`
+	Seed      string `json:"seed,omitempty"`
+	Time      uint64 `json:"time"`
+}
+
+func indexPos(block uint64, index uint) []byte {
+	var k [12]byte
+	binary.BigEndian.PutUint64(k[:8], block)
+	binary.BigEndian.PutUint32(k[8:], uint32(index))
+	return k[:]
+}
+
+func indexKey(prefix string, id []byte, pos []byte) []byte {
+	key := append([]byte(prefix), id...)
+	return append(key, pos...)
+}
+
+// SetOracleEvent stores e with its committer, consumer and hash indexes,
+// storing the same event again changes nothing.
+func SetOracleEvent(w KeyValueWriter, e OracleEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	pos := indexPos(e.Block, e.LogIndex)
+	if err := w.Set(indexKey(prefixIndexEvent, nil, pos), data); err != nil {
+		return err
+	}
+	if err := w.Set(indexKey(prefixIndexCommitter, common.HexToAddress(e.Committer).Bytes(), pos), pos); err != nil {
+		return err
+	}
+	if e.Consumer != "" {
+		if err := w.Set(indexKey(prefixIndexConsumer, common.HexToAddress(e.Consumer).Bytes(), pos), pos); err != nil {
+			return err
+		}
+	}
+	return w.Set(indexKey(prefixIndexHash, common.HexToHash(e.Hash).Bytes(), pos), pos)
+}
+
+// EventQuery selects indexed events, empty fields match everything. From
+// and To limit the blocks, To zero means no limit.
+type EventQuery struct {
+	Event     string
+	Committer string
+	Consumer  string
+	Hash      string
+	From      uint64
+	To        uint64
+	Limit     int
+}
+
+func (q EventQuery) Match(e OracleEvent) bool {
+	if q.Event != "" && !strings.EqualFold(q.Event, e.Event) {
+		return false
+	}
+	if q.Committer != "" && !strings.EqualFold(q.Committer, e.Committer) {
+		return false
+	}
+	if q.Consumer != "" && !strings.EqualFold(q.Consumer, e.Consumer) {
+		return false
+	}
+	if q.Hash != "" && !strings.EqualFold(q.Hash, e.Hash) {
+		return false
+	}
+	return e.Block >= q.From && (q.To == 0 || e.Block <= q.To)
+}
+
+// QueryOracleEvents returns the events matching q in chain order, at most
+// q.Limit of them. The most selective index of q is scanned from the block
+// q.From on, a query by blocks only must name both ends.
+func QueryOracleEvents(ldb Store, q EventQuery) ([]OracleEvent, error) {
+	if q.Limit <= 0 || q.Limit > MaxIndexQuery {
+		q.Limit = MaxIndexQuery
+	}
+	if q.Hash != "" {
+		q.Hash = common.HexToHash(q.Hash).Hex()
+	}
+	if q.Committer != "" {
+		q.Committer = common.HexToAddress(q.Committer).Hex()
+	}
+	if q.Consumer != "" {
+		q.Consumer = common.HexToAddress(q.Consumer).Hex()
+	}
+	list := make([]OracleEvent, 0)
+	add := func(data []byte) bool {
+		var e OracleEvent
+		if json.Unmarshal(data, &e) == nil && q.Match(e) {
+			list = append(list, e)
+		}
+		return len(list) < q.Limit
+	}
+
+	var prefix []byte
+	switch {
+	case q.Hash != "":
+		prefix = indexKey(prefixIndexHash, common.HexToHash(q.Hash).Bytes(), nil)
+	case q.Consumer != "":
+		prefix = indexKey(prefixIndexConsumer, common.HexToAddress(q.Consumer).Bytes(), nil)
+	case q.Committer != "":
+		prefix = indexKey(prefixIndexCommitter, common.HexToAddress(q.Committer).Bytes(), nil)
+	}
+	if prefix != nil {
+		// the index keys end with the position, so the scan starts at the
+		// block From and stops after To.
+		var getErr error
+		err := ldb.Seek(prefix, append(append([]byte{}, prefix...), indexPos(q.From, 0)...), func(k, pos []byte) bool {
+			if len(pos) != 12 {
+				return true
+			}
+			if q.To != 0 && binary.BigEndian.Uint64(pos[:8]) > q.To {
+				return false
+			}
+			data, exist, err := ldb.Get(indexKey(prefixIndexEvent, nil, pos))
+			if err != nil {
+				getErr = err
+				return false
+			}
+			return !exist || add(data)
+		})
+		if err == nil {
+			err = getErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+
+	if q.To < q.From || q.To-q.From >= MaxIndexQuery {
+		return nil, fmt.Errorf("a query by blocks only needs from and to at most %d blocks apart", MaxIndexQuery-1)
+	}
+	err := ldb.Seek([]byte(prefixIndexEvent), indexKey(prefixIndexEvent, nil, indexPos(q.From, 0)), func(k, v []byte) bool {
+		if binary.BigEndian.Uint64(k[len(prefixIndexEvent):]) > q.To {
+			return false
+		}
+		return add(v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
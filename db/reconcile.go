@@ -0,0 +1,61 @@
+package db
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+)
+
+const prefixReconcile = "krecon"
+
+// drift between the local commit state and the oracle, named after the fix.
+const (
+	DriftExpired  = "expired"  // expired on chain, no longer waits for a reveal
+	DriftRevealed = "revealed" // revealed on chain but the event was missed
+	DriftPhantom  = "phantom"  // never landed on chain
+)
+
+type DriftChange struct {
+	Commit string `json:"commit"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+// ReconcileReport is the outcome of one comparison of the local commits
+// waiting for a reveal with the oracle.
+type ReconcileReport struct {
+	Time       int64         `json:"time"`
+	Block      uint64        `json:"block"`
+	Local      int           `json:"local"`
+	Unverified int           `json:"unverified"`
+	Changes    []DriftChange `json:"changes"`
+}
+
+func AppendReconcileReport(w KeyValueWriter, r ReconcileReport) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	var t [8]byte
+	binary.BigEndian.PutUint64(t[:], uint64(time.Now().UnixNano()))
+	return w.Set(append([]byte(prefixReconcile), t[:]...), data)
+}
+
+// GetReconcileReports returns the stored reports, newest first, at most
+// limit of them when limit is positive.
+func GetReconcileReports(ldb Store, limit int) []ReconcileReport {
+	list := make([]ReconcileReport, 0)
+	ldb.Iterator([]byte(prefixReconcile), func(k, v []byte) {
+		var r ReconcileReport
+		if json.Unmarshal(v, &r) == nil {
+			list = append(list, r)
+		}
+	})
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
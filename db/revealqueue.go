@@ -0,0 +1,54 @@
+package db
+
+import (
+	"encoding/json"
+)
+
+const prefixRevealJob = "kqreveal"
+
+// RevealJob is a pending reveal of one of our commits. Deadline is the
+// last block the oracle accepts the reveal in, 0 while unknown.
+type RevealJob struct {
+	Commit      []byte `json:"commit"`
+	Attempts    int    `json:"attempts"`
+	NextAttempt int64  `json:"nextAttempt"`
+	Deadline    uint64 `json:"deadline"`
+	LastError   string `json:"lastError,omitempty"`
+	Created     int64  `json:"created"`
+}
+
+func keyRevealJob(hash []byte) []byte {
+	return append([]byte(prefixRevealJob), hash...)
+}
+
+func SetRevealJob(w KeyValueWriter, job RevealJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return w.Set(keyRevealJob(job.Commit), data)
+}
+
+func GetRevealJob(ldb Store, hash []byte) (RevealJob, bool) {
+	var job RevealJob
+	data, exist := get(ldb, keyRevealJob(hash))
+	if !exist || json.Unmarshal(data, &job) != nil {
+		return job, false
+	}
+	return job, true
+}
+
+func DelRevealJob(w KeyValueWriter, hash []byte) error {
+	return w.Delete(keyRevealJob(hash))
+}
+
+func GetAllRevealJobs(ldb Store) []RevealJob {
+	jobs := make([]RevealJob, 0)
+	ldb.Iterator([]byte(prefixRevealJob), func(k, v []byte) {
+		var job RevealJob
+		if json.Unmarshal(v, &job) == nil {
+			jobs = append(jobs, job)
+		}
+	})
+	return jobs
+}
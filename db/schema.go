@@ -0,0 +1,134 @@
+package db
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/hpb-project/srng-robot/log"
+)
+
+const keySchemaVersion = "schemaVersion"
+
+// Migration upgrades the store from Version-1 to Version. Up reads from the
+// database and queues its changes into b, the batch is written together with
+// the new schema version so a migration is applied completely or not at all.
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      func(ldb Store, b Batch) error
+}
+
+// migrations must stay ordered by version, append new ones at the end.
+var migrations = []Migration{
+	{Version: 1, Name: "rebuild revealed and tx indexes", Up: rebuildIndexes},
+}
+
+// SchemaVersion returns the version the store was migrated to, zero for a
+// store created before versioning.
+func SchemaVersion(ldb Store) uint64 {
+	version, _ := schemaVersion(ldb)
+	return version
+}
+
+func schemaVersion(ldb Store) (uint64, error) {
+	value, exist, err := ldb.Get([]byte(keySchemaVersion))
+	if err != nil || !exist || len(value) != 8 {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(value), nil
+}
+
+// LatestSchemaVersion is the version this build expects.
+func LatestSchemaVersion() uint64 {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+func setSchemaVersion(b Batch, version uint64) error {
+	var value [8]byte
+	binary.BigEndian.PutUint64(value[:], version)
+	return b.Set([]byte(keySchemaVersion), value[:])
+}
+
+// Migrate runs every pending migration in order. In dry run mode each
+// migration is executed but its batch is dropped, so the log shows what
+// would change while the store stays untouched.
+func Migrate(ldb Store, dryRun bool) error {
+	version, err := schemaVersion(ldb)
+	if err != nil {
+		return fmt.Errorf("read db schema version failed: %v", err)
+	}
+	if version > LatestSchemaVersion() {
+		return fmt.Errorf("db schema version %d is newer than supported version %d", version, LatestSchemaVersion())
+	}
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+		b := ldb.NewBatch()
+		if err := m.Up(ldb, b); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		if err := setSchemaVersion(b, m.Version); err != nil {
+			return err
+		}
+		if dryRun {
+			log.Info("dry run migration", "version", m.Version, "name", m.Name, "size", b.ValueSize())
+			continue
+		}
+		if err := b.Write(); err != nil {
+			return fmt.Errorf("write migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		log.Info("db migrated", "version", m.Version, "name", m.Name, "size", b.ValueSize())
+	}
+	return nil
+}
+
+// Stores before version 1 wrote the seed of a commit before its tx was
+// sent, so a stored seed doesn't prove the commit landed or was revealed,
+// and they kept no commit or reveal txs at all. Both indexes can only be
+// rebuilt from the oracle logs, the migrations schedule that scan and the
+// sync runs it, see IndexBackfillPending.
+const keyIndexBackfill = "indexBackfill"
+
+// IndexBackfillPending reports whether the revealed and tx indexes still
+// have to be rebuilt from the oracle logs up to the sync cursor.
+func IndexBackfillPending(ldb Store) bool {
+	_, exist := get(ldb, []byte(keyIndexBackfill))
+	return exist
+}
+
+func ClearIndexBackfill(w KeyValueWriter) error {
+	return w.Delete([]byte(keyIndexBackfill))
+}
+
+func scheduleIndexBackfill(ldb Store, b Batch) error {
+	log.Info("revealed and tx indexes are rebuilt from the oracle logs by the sync")
+	return b.Set([]byte(keyIndexBackfill), []byte{1})
+}
+
+// rebuildIndexes drops the revealed marks that have no reveal tx, a store
+// from before version 1 can't prove them, and schedules the backfill that
+// restores the marks and txs the oracle logs confirm.
+func rebuildIndexes(ldb Store, b Batch) error {
+	hashes := make([][]byte, 0)
+	err := ldb.Iterator([]byte(prefixRevealedSeed), func(k, v []byte) {
+		hash := make([]byte, len(k)-len(prefixRevealedSeed))
+		copy(hash, k[len(prefixRevealedSeed):])
+		if _, exist := GetTxBySeedHash(ldb, hash); !exist {
+			hashes = append(hashes, hash)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if err := b.Delete(keySeedHashRevealed(hash)); err != nil {
+			return err
+		}
+	}
+	log.Info("drop unproven revealed marks", "count", len(hashes))
+	return scheduleIndexBackfill(ldb, b)
+}
@@ -0,0 +1,343 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/hpb-project/srng-robot/log"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// dialect holds the statements that differ between sql backends.
+type dialect struct {
+	driver string
+	schema []string
+	get    string
+	has    string
+	set    string
+	del    string
+	scan   string
+	scanTo string
+	insert string
+	swap   string
+}
+
+var sqliteDialect = dialect{
+	driver: "sqlite3",
+	schema: []string{
+		`CREATE TABLE IF NOT EXISTS kv (k BLOB PRIMARY KEY, v BLOB NOT NULL)`,
+		// readable views over the commit keys for ad-hoc queries.
+		`CREATE VIEW IF NOT EXISTS seeds AS SELECT lower(hex(substr(k, 4))) AS hash, lower(hex(v)) AS seed FROM kv WHERE substr(k, 1, 3) = CAST('kss' AS BLOB)`,
+		`CREATE VIEW IF NOT EXISTS unrevealed AS SELECT lower(hex(substr(k, 10))) AS hash FROM kv WHERE substr(k, 1, 9) = CAST('kunreveal' AS BLOB)`,
+		`CREATE VIEW IF NOT EXISTS revealed AS SELECT lower(hex(substr(k, 10))) AS hash FROM kv WHERE substr(k, 1, 9) = CAST('krevealed' AS BLOB)`,
+		// commit history from the lifecycle stages, one row per commit.
+		`CREATE VIEW IF NOT EXISTS commits AS SELECT lower(hex(substr(c.k, 9))) AS hash,
+			json_extract(CAST(c.v AS TEXT), '$.block') AS commit_block,
+			json_extract(CAST(c.v AS TEXT), '$.time') AS commit_time,
+			json_extract(CAST(c.v AS TEXT), '$.tx') AS commit_tx,
+			json_extract(CAST(s.v AS TEXT), '$.consumer') AS consumer,
+			json_extract(CAST(s.v AS TEXT), '$.block') AS subscribe_block,
+			json_extract(CAST(r.v AS TEXT), '$.block') AS reveal_block,
+			json_extract(CAST(r.v AS TEXT), '$.tx') AS reveal_tx,
+			json_extract(CAST(e.v AS TEXT), '$.block') AS expired_block
+			FROM kv c
+			LEFT JOIN kv s ON s.k = CAST(CAST('klsub' AS BLOB) || substr(c.k, 9) AS BLOB)
+			LEFT JOIN kv r ON r.k = CAST(CAST('klreveal' AS BLOB) || substr(c.k, 9) AS BLOB)
+			LEFT JOIN kv e ON e.k = CAST(CAST('klexpired' AS BLOB) || substr(c.k, 9) AS BLOB)
+			WHERE substr(c.k, 1, 8) = CAST('klcommit' AS BLOB)`,
+		// the next block to sync, the cursor is a big-endian integer.
+		`CREATE VIEW IF NOT EXISTS sync_cursor AS WITH RECURSIVE h(s) AS (SELECT hex(v) FROM kv WHERE k = CAST('lastSyncBlock' AS BLOB)),
+			d(i, n) AS (SELECT 0, 0 UNION ALL SELECT i + 1, n * 16 + instr('0123456789ABCDEF', substr((SELECT s FROM h), i + 1, 1)) - 1
+			FROM d WHERE i < length((SELECT s FROM h)))
+			SELECT n AS next_block FROM d WHERE i = length((SELECT s FROM h))`,
+	},
+	get:    `SELECT v FROM kv WHERE k = ?`,
+	has:    `SELECT 1 FROM kv WHERE k = ?`,
+	set:    `INSERT INTO kv (k, v) VALUES (?, ?) ON CONFLICT (k) DO UPDATE SET v = excluded.v`,
+	del:    `DELETE FROM kv WHERE k = ?`,
+	scan:   `SELECT k, v FROM kv WHERE k >= ? ORDER BY k`,
+	scanTo: `SELECT k, v FROM kv WHERE k >= ? AND k < ? ORDER BY k`,
+	insert: `INSERT INTO kv (k, v) VALUES (?, ?) ON CONFLICT (k) DO NOTHING`,
+	swap:   `UPDATE kv SET v = ? WHERE k = ? AND v = ?`,
+}
+
+var postgresDialect = dialect{
+	driver: "postgres",
+	schema: []string{
+		`CREATE TABLE IF NOT EXISTS kv (k BYTEA PRIMARY KEY, v BYTEA NOT NULL)`,
+		`CREATE OR REPLACE VIEW seeds AS SELECT encode(substr(k, 4), 'hex') AS hash, encode(v, 'hex') AS seed FROM kv WHERE substr(k, 1, 3) = 'kss'`,
+		`CREATE OR REPLACE VIEW unrevealed AS SELECT encode(substr(k, 10), 'hex') AS hash FROM kv WHERE substr(k, 1, 9) = 'kunreveal'`,
+		`CREATE OR REPLACE VIEW revealed AS SELECT encode(substr(k, 10), 'hex') AS hash FROM kv WHERE substr(k, 1, 9) = 'krevealed'`,
+		`CREATE OR REPLACE VIEW commits AS SELECT encode(substr(c.k, 9), 'hex') AS hash,
+			(convert_from(c.v, 'UTF8')::json->>'block')::bigint AS commit_block,
+			(convert_from(c.v, 'UTF8')::json->>'time')::bigint AS commit_time,
+			convert_from(c.v, 'UTF8')::json->>'tx' AS commit_tx,
+			convert_from(s.v, 'UTF8')::json->>'consumer' AS consumer,
+			(convert_from(s.v, 'UTF8')::json->>'block')::bigint AS subscribe_block,
+			(convert_from(r.v, 'UTF8')::json->>'block')::bigint AS reveal_block,
+			convert_from(r.v, 'UTF8')::json->>'tx' AS reveal_tx,
+			(convert_from(e.v, 'UTF8')::json->>'block')::bigint AS expired_block
+			FROM kv c
+			LEFT JOIN kv s ON s.k = 'klsub'::bytea || substr(c.k, 9)
+			LEFT JOIN kv r ON r.k = 'klreveal'::bytea || substr(c.k, 9)
+			LEFT JOIN kv e ON e.k = 'klexpired'::bytea || substr(c.k, 9)
+			WHERE substr(c.k, 1, 8) = 'klcommit'`,
+		`CREATE OR REPLACE VIEW sync_cursor AS SELECT ('x' || lpad(encode(v, 'hex'), 16, '0'))::bit(64)::bigint AS next_block
+			FROM kv WHERE k = 'lastSyncBlock'`,
+	},
+	get:    `SELECT v FROM kv WHERE k = $1`,
+	has:    `SELECT 1 FROM kv WHERE k = $1`,
+	set:    `INSERT INTO kv (k, v) VALUES ($1, $2) ON CONFLICT (k) DO UPDATE SET v = excluded.v`,
+	del:    `DELETE FROM kv WHERE k = $1`,
+	scan:   `SELECT k, v FROM kv WHERE k >= $1 ORDER BY k`,
+	scanTo: `SELECT k, v FROM kv WHERE k >= $1 AND k < $2 ORDER BY k`,
+	insert: `INSERT INTO kv (k, v) VALUES ($1, $2) ON CONFLICT (k) DO NOTHING`,
+	swap:   `UPDATE kv SET v = $1 WHERE k = $2 AND v = $3`,
+}
+
+// SQLDB is a Store on top of a single key-value table in a sql database.
+type SQLDB struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// NewSQLite opens or creates a sqlite database file.
+func NewSQLite(path string) (*SQLDB, error) {
+	return newSQLDB(sqliteDialect, path)
+}
+
+// NewPostgres connects to a postgres database, the kv table is created if
+// it doesn't exist yet.
+func NewPostgres(dsn string) (*SQLDB, error) {
+	return newSQLDB(postgresDialect, dsn)
+}
+
+func newSQLDB(d dialect, dsn string) (*SQLDB, error) {
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if d.driver == sqliteDialect.driver {
+		// sqlite allows one writer, serialize access instead of failing
+		// with database is locked.
+		db.SetMaxOpenConns(1)
+	}
+	for _, stmt := range d.schema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("create %s schema failed: %v", d.driver, err)
+		}
+	}
+	return &SQLDB{db: db, dialect: d}, nil
+}
+
+// Close closes the database connection.
+func (db *SQLDB) Close() error {
+	return db.db.Close()
+}
+
+// Has retrieves if a key is present in the store.
+func (db *SQLDB) Has(key interface{}) (bool, error) {
+	var one int
+	err := db.db.QueryRow(db.dialect.has, key.([]byte)).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Get retrieves the given key if it's present in the store.
+func (db *SQLDB) Get(key interface{}) ([]byte, bool, error) {
+	var value []byte
+	err := db.db.QueryRow(db.dialect.get, key.([]byte)).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		log.Error("sql get failed", "driver", db.dialect.driver, "err", err)
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set inserts or replaces the given value.
+func (db *SQLDB) Set(key interface{}, value []byte) error {
+	_, err := db.db.Exec(db.dialect.set, key.([]byte), value)
+	return err
+}
+
+// Delete removes the key from the store.
+func (db *SQLDB) Delete(key interface{}) error {
+	_, err := db.db.Exec(db.dialect.del, key.([]byte))
+	return err
+}
+
+// CompareAndSwap sets key to value if its current value equals old, the
+// check and the write are one statement so concurrent instances sharing the
+// database can't both win.
+func (db *SQLDB) CompareAndSwap(key interface{}, old []byte, value []byte) (bool, error) {
+	var res sql.Result
+	var err error
+	if old == nil {
+		res, err = db.db.Exec(db.dialect.insert, key.([]byte), value)
+	} else {
+		res, err = db.db.Exec(db.dialect.swap, value, key.([]byte), old)
+	}
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// Iterator loads the matching rows before calling iterfunc, so iterfunc may
+// use the store again without waiting for the connection held by the query.
+func (db *SQLDB) Iterator(prefix []byte, iterfunc func(key, value []byte)) error {
+	r := util.BytesPrefix(prefix)
+	keys, values, err := db.scan(append([]byte{}, r.Start...), r.Limit, "")
+	if err != nil {
+		return err
+	}
+	if iterfunc == nil {
+		return nil
+	}
+	for i := range keys {
+		iterfunc(keys[i], values[i])
+	}
+	return nil
+}
+
+// scan loads the rows from start up to limit, limit nil means no end.
+func (db *SQLDB) scan(start []byte, limit []byte, suffix string) ([][]byte, [][]byte, error) {
+	var rows *sql.Rows
+	var err error
+	if limit == nil {
+		rows, err = db.db.Query(db.dialect.scan+suffix, start)
+	} else {
+		rows, err = db.db.Query(db.dialect.scanTo+suffix, start, limit)
+	}
+	if err != nil {
+		log.Error("sql scan failed", "driver", db.dialect.driver, "err", err)
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var keys, values [][]byte
+	for rows.Next() {
+		var key, value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			log.Error("sql scan failed", "driver", db.dialect.driver, "err", err)
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("sql scan failed", "driver", db.dialect.driver, "err", err)
+		return nil, nil, err
+	}
+	return keys, values, nil
+}
+
+// seekPage is how many rows Seek loads per query.
+const seekPage = 256
+
+// Seek loads the rows a page at a time, so fn may stop early without the
+// rest being read and may use the store like in Iterator.
+func (db *SQLDB) Seek(prefix []byte, start []byte, fn func(key, value []byte) bool) error {
+	r := util.BytesPrefix(prefix)
+	if bytes.Compare(start, r.Start) > 0 {
+		r.Start = start
+	}
+	from := append([]byte{}, r.Start...)
+	for {
+		keys, values, err := db.scan(from, r.Limit, fmt.Sprintf(" LIMIT %d", seekPage))
+		if err != nil {
+			return err
+		}
+		for i := range keys {
+			if !fn(keys[i], values[i]) {
+				return nil
+			}
+		}
+		if len(keys) < seekPage {
+			return nil
+		}
+		// the smallest key after the last one.
+		from = append(keys[len(keys)-1], 0)
+	}
+}
+
+// NewBatch creates a batch that is written in one sql transaction.
+func (db *SQLDB) NewBatch() Batch {
+	return &sqlBatch{db: db}
+}
+
+// Update runs fn with a new batch and writes the batch only if fn succeeds.
+func (db *SQLDB) Update(fn func(b Batch) error) error {
+	b := db.NewBatch()
+	if err := fn(b); err != nil {
+		return err
+	}
+	return b.Write()
+}
+
+type sqlOp struct {
+	key   []byte
+	value []byte
+	del   bool
+}
+
+// sqlBatch queues writes and applies them in a single transaction.
+type sqlBatch struct {
+	db   *SQLDB
+	ops  []sqlOp
+	size int
+}
+
+func (b *sqlBatch) Set(key interface{}, value []byte) error {
+	k := key.([]byte)
+	b.ops = append(b.ops, sqlOp{key: append([]byte{}, k...), value: append([]byte{}, value...)})
+	b.size += len(k) + len(value)
+	return nil
+}
+
+func (b *sqlBatch) Delete(key interface{}) error {
+	k := key.([]byte)
+	b.ops = append(b.ops, sqlOp{key: append([]byte{}, k...), del: true})
+	b.size += len(k)
+	return nil
+}
+
+func (b *sqlBatch) ValueSize() int {
+	return b.size
+}
+
+func (b *sqlBatch) Write() error {
+	if len(b.ops) == 0 {
+		return nil
+	}
+	tx, err := b.db.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, op := range b.ops {
+		if op.del {
+			_, err = tx.Exec(b.db.dialect.del, op.key)
+		} else {
+			_, err = tx.Exec(b.db.dialect.set, op.key, op.value)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (b *sqlBatch) Reset() {
+	b.ops = b.ops[:0]
+	b.size = 0
+}
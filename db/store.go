@@ -0,0 +1,104 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hpb-project/srng-robot/log"
+)
+
+// Store is the key-value storage the robot keeps its state in. Every helper
+// in this package works on a Store, so the backend is picked by config.
+type Store interface {
+	KeyValueWriter
+
+	// Has retrieves if a key is present in the store.
+	Has(key interface{}) (bool, error)
+
+	// Get retrieves the given key if it's present in the store. A missing
+	// key is not an error, a failing backend is and is logged as well, so
+	// callers that can live with a miss may ignore it.
+	Get(key interface{}) ([]byte, bool, error)
+
+	// Iterator calls iterfunc for every key with the given prefix in
+	// binary-alphabetical order. An error means the keys may be incomplete.
+	Iterator(prefix []byte, iterfunc func(key, value []byte)) error
+
+	// Seek calls fn for the keys with the given prefix from start on in
+	// binary-alphabetical order until fn returns false.
+	Seek(prefix []byte, start []byte, fn func(key, value []byte) bool) error
+
+	// NewBatch creates a batch that writes to the store atomically.
+	NewBatch() Batch
+
+	// Update runs fn with a new batch and writes it if fn succeeds.
+	Update(fn func(b Batch) error) error
+
+	// CompareAndSwap sets key to value if its current value equals old, a
+	// nil old means the key must not exist yet. It reports whether the
+	// value was set.
+	CompareAndSwap(key interface{}, old []byte, value []byte) (bool, error)
+
+	// Close flushes pending data and releases the backend.
+	Close() error
+}
+
+// get is Get for the reads that may treat a failing backend like a missing
+// key, the backend has logged the error.
+func get(ldb Store, key []byte) ([]byte, bool) {
+	value, exist, _ := ldb.Get(key)
+	return value, exist
+}
+
+const (
+	DriverLevelDB  = "leveldb"
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// Open opens the store of the given driver, path is a directory for
+// leveldb, a file for sqlite and a connection string for postgres.
+func Open(driver string, path string) (Store, error) {
+	switch strings.ToLower(driver) {
+	case "", DriverLevelDB:
+		return New(path, 1000, 1000)
+	case DriverSQLite:
+		return NewSQLite(path)
+	case DriverPostgres:
+		return NewPostgres(path)
+	default:
+		return nil, fmt.Errorf("unknown db driver %s", driver)
+	}
+}
+
+// Copy writes every key of src into dst, existing keys in dst are
+// overwritten. It returns the number of copied keys.
+func Copy(src Store, dst Store) (int, error) {
+	const flushSize = 1024 * 1024
+
+	count := 0
+	var err error
+	b := dst.NewBatch()
+	iterErr := src.Iterator(nil, func(k, v []byte) {
+		if err != nil {
+			return
+		}
+		if err = b.Set(k, v); err != nil {
+			return
+		}
+		count++
+		if b.ValueSize() >= flushSize {
+			if err = b.Write(); err == nil {
+				b.Reset()
+				log.Info("copy db", "count", count)
+			}
+		}
+	})
+	if err != nil {
+		return count, err
+	}
+	if iterErr != nil {
+		return count, iterErr
+	}
+	return count, b.Write()
+}
@@ -6,7 +6,9 @@ require (
 	github.com/astaxie/beego v1.12.3
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/ethereum/go-ethereum v1.10.21
-	github.com/prometheus/common v0.10.0
+	github.com/lib/pq v1.10.7
+	github.com/mattn/go-sqlite3 v2.0.3+incompatible
+	github.com/prometheus/common v0.10.0 // indirect
 	github.com/shopspring/decimal v1.3.1
 	golang.org/x/crypto v0.0.0-20220817201139-bc19a97f63c8
 	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
@@ -50,3 +52,7 @@ require (
 	gopkg.in/natefinch/npipe.v2 v2.0.0-20160621034901-c1b8fa8bdcce // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
+
+// v2.0.3+incompatible is a mis-tagged release that beego still requires, pin
+// the maintained v1.14 line.
+replace github.com/mattn/go-sqlite3 => github.com/mattn/go-sqlite3 v1.14.16
@@ -0,0 +1,136 @@
+// Package log is the structured logger of the robot. Messages carry key
+// value fields, use the field names below so the lines of one commit can be
+// followed from commit to reveal.
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/logs"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// common field names.
+const (
+	FieldCommit = "commit"
+	FieldTx     = "tx"
+	FieldNonce  = "nonce"
+	FieldBlock  = "block"
+)
+
+type Logger = log.Logger
+
+type Options struct {
+	Format     string // json or text
+	File       string // stdout when empty
+	MaxSize    int    // megabytes before the file is rotated
+	MaxBackups int    // rotated files to keep
+}
+
+var (
+	level  = int32(log.LvlInfo)
+	output io.WriteCloser
+)
+
+func init() {
+	log.Root().SetHandler(levelHandler(log.StreamHandler(os.Stdout, log.TerminalFormat(false))))
+}
+
+// levelHandler drops records above the current level, the level can be
+// changed at any time with SetLevel.
+func levelHandler(h log.Handler) log.Handler {
+	return log.FuncHandler(func(r *log.Record) error {
+		if r.Lvl > log.Lvl(atomic.LoadInt32(&level)) {
+			return nil
+		}
+		return h.Log(r)
+	})
+}
+
+// Setup directs the log to the configured output and routes the beego
+// framework logs through it as well.
+func Setup(opts Options) error {
+	var w io.WriteCloser = os.Stdout
+	if opts.File != "" {
+		f, err := NewRotateFile(opts.File, opts.MaxSize, opts.MaxBackups)
+		if err != nil {
+			return err
+		}
+		w = f
+	}
+	var format log.Format
+	switch strings.ToLower(opts.Format) {
+	case "", "json":
+		format = log.JSONFormatEx(false, true)
+	case "text":
+		format = log.LogfmtFormat()
+	default:
+		return fmt.Errorf("unknown log format %s", opts.Format)
+	}
+	log.Root().SetHandler(levelHandler(log.SyncHandler(log.StreamHandler(w, format))))
+	if output != nil && output != os.Stdout {
+		output.Close()
+	}
+	output = w
+
+	logs.Register("srng", func() logs.Logger { return beegoAdapter{} })
+	beego.BeeLogger.DelLogger(logs.AdapterConsole)
+	beego.BeeLogger.SetLogger("srng")
+	beego.BeeLogger.SetLevel(logs.LevelDebug)
+	beego.BeeLogger.EnableFuncCallDepth(false)
+	return nil
+}
+
+// SetLevel changes the level of the log, one of crit, error, warn, info,
+// debug or trace.
+func SetLevel(name string) error {
+	lvl, err := log.LvlFromString(strings.ToLower(name))
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&level, int32(lvl))
+	return nil
+}
+
+// New returns a logger adding ctx to every message.
+func New(ctx ...interface{}) Logger {
+	return log.New(ctx...)
+}
+
+func Debug(msg string, ctx ...interface{}) { log.Debug(msg, ctx...) }
+func Info(msg string, ctx ...interface{})  { log.Info(msg, ctx...) }
+func Warn(msg string, ctx ...interface{})  { log.Warn(msg, ctx...) }
+func Error(msg string, ctx ...interface{}) { log.Error(msg, ctx...) }
+
+// beegoAdapter forwards the already formatted beego messages.
+type beegoAdapter struct{}
+
+func (beegoAdapter) Init(config string) error { return nil }
+
+func (beegoAdapter) WriteMsg(when time.Time, msg string, lvl int) error {
+	// beego puts the level in front of the message, the record has its own.
+	if len(msg) > 3 && msg[0] == '[' && msg[2] == ']' {
+		msg = msg[3:]
+	}
+	msg = strings.TrimSpace(msg)
+	switch {
+	case lvl <= logs.LevelError:
+		log.Error(msg, "module", "beego")
+	case lvl == logs.LevelWarn:
+		log.Warn(msg, "module", "beego")
+	case lvl == logs.LevelDebug:
+		log.Debug(msg, "module", "beego")
+	default:
+		log.Info(msg, "module", "beego")
+	}
+	return nil
+}
+
+func (beegoAdapter) Destroy() {}
+func (beegoAdapter) Flush()   {}
@@ -0,0 +1,82 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RotateFile is a log file that is renamed with a timestamp suffix once it
+// grows over maxSize megabytes, only the newest maxBackups renamed files
+// are kept.
+type RotateFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func NewRotateFile(path string, maxSize int, maxBackups int) (*RotateFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	r := &RotateFile{path: path, maxSize: int64(maxSize) << 20, maxBackups: maxBackups}
+	return r, r.open()
+}
+
+func (r *RotateFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	return nil
+}
+
+func (r *RotateFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxSize > 0 && r.size+int64(len(p)) > r.maxSize && r.size > 0 {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotateFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	backup := fmt.Sprintf("%s.%s", r.path, time.Now().Format("20060102-150405.000"))
+	if err := os.Rename(r.path, backup); err != nil {
+		return err
+	}
+	if r.maxBackups > 0 {
+		backups, _ := filepath.Glob(r.path + ".*")
+		sort.Strings(backups)
+		for len(backups) > r.maxBackups {
+			os.Remove(backups[0])
+			backups = backups[1:]
+		}
+	}
+	return r.open()
+}
+
+func (r *RotateFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
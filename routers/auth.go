@@ -0,0 +1,83 @@
+package routers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/context"
+	"github.com/hpb-project/srng-robot/config"
+	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/log"
+	"github.com/hpb-project/srng-robot/services/apikey"
+	"github.com/hpb-project/srng-robot/utils"
+)
+
+func abort(ctx *context.Context, code int, msg string) {
+	ctx.Output.SetStatus(code)
+	ctx.Output.JSON(map[string]interface{}{"error": http.StatusText(code), "err_msg": msg, "data": nil}, false, false)
+}
+
+// operatorReads are the admin reads that put a load on the node worth
+// keeping from read tokens, a replay dry-run fetches every log of its range.
+var operatorReads = map[string]bool{
+	"/robot/admin/replay": true,
+}
+
+// JwtAuth checks the bearer token of admin requests. Reading needs the read
+// or operator role, everything else and the operatorReads need the operator
+// role.
+func JwtAuth(ctx *context.Context) {
+	auth := ctx.Input.Header("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		abort(ctx, http.StatusUnauthorized, "missing bearer token")
+		return
+	}
+	claims, err := utils.ParseJwt(strings.TrimPrefix(auth, "Bearer "))
+	if err != nil {
+		abort(ctx, http.StatusUnauthorized, "invalid token")
+		return
+	}
+	allowed := claims.HasRole(utils.RoleOperator)
+	if ctx.Input.Method() == http.MethodGet && !operatorReads[strings.TrimSuffix(ctx.Input.URL(), "/")] {
+		allowed = allowed || claims.HasRole(utils.RoleRead)
+	}
+	if !allowed {
+		abort(ctx, http.StatusForbidden, "permission denied")
+		return
+	}
+	ctx.Input.SetData("user", claims.UserId)
+	if ctx.Input.Method() != http.MethodGet {
+		log.Info("admin request", "user", claims.UserId, "path", ctx.Input.URL())
+	}
+}
+
+// ApiKeyAuth verifies the hmac signed requests of integrators, rejects
+// replayed ones and applies the per key rate limit.
+func ApiKeyAuth(ldb db.Store) beego.FilterFunc {
+	limiter := apikey.NewLimiter()
+	nonces := apikey.NewNonces()
+	return func(ctx *context.Context) {
+		r := ctx.Request
+		nonce := r.Header.Get(apikey.HeaderNonce)
+		k, err := apikey.Verify(ldb, r.Header.Get(apikey.HeaderKey), r.Method, r.URL.Path, r.URL.RawQuery,
+			r.Header.Get(apikey.HeaderTimestamp), nonce, r.Header.Get(apikey.HeaderSignature))
+		if err != nil {
+			abort(ctx, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if !nonces.Use(k.Key, nonce) {
+			abort(ctx, http.StatusUnauthorized, apikey.ErrBadNonce.Error())
+			return
+		}
+		rate := k.RateLimit
+		if rate <= 0 {
+			rate = config.Current().ApiRateLimit
+		}
+		if !limiter.Allow(k.Key, rate) {
+			abort(ctx, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		ctx.Input.SetData("apikey", k.Key)
+	}
+}
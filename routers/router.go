@@ -2,18 +2,52 @@ package routers
 
 import (
 	"github.com/astaxie/beego"
+	"github.com/hpb-project/srng-robot/config"
 	"github.com/hpb-project/srng-robot/controllers"
 	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/log"
+	"github.com/hpb-project/srng-robot/utils"
 )
 
-func Init(ldb *db.LevelDB) {
+func Init(ldb db.Store, admin controllers.Admin) {
 	ctl := controllers.NewController(ldb)
 	ns := beego.NewNamespace("/robot",
-		beego.NSNamespace("api",
+		beego.NSNamespace("v1",
+			beego.NSBefore(ApiKeyAuth(ldb)),
 			beego.NSRouter("/getseed", ctl, "get:GetSeed"),
-			//beego.NSRouter("/reveal", ctl, "post:ConsumedOneDay"),
+			beego.NSRouter("/commit", ctl, "get:GetCommit"),
+			beego.NSRouter("/revealed", ctl, "get:GetRevealed"),
 		),
 	)
+	// the unsigned api of older integrations.
+	if config.Current().LegacyApi {
+		ns.Namespace(beego.NewNamespace("api",
+			beego.NSRouter("/getseed", ctl, "get:LegacyGetSeed"),
+			//beego.NSRouter("/reveal", ctl, "post:ConsumedOneDay"),
+		))
+	}
+	if utils.JwtEnabled() {
+		adm := controllers.NewAdminController(ldb, admin)
+		ns.Namespace(beego.NewNamespace("admin",
+			beego.NSBefore(JwtAuth),
+			beego.NSRouter("/status", adm, "get:Status"),
+			beego.NSRouter("/reveal", adm, "post:Reveal"),
+			beego.NSRouter("/approve", adm, "post:Approve"),
+			beego.NSRouter("/gas", adm, "post:SetGas"),
+			beego.NSRouter("/pause", adm, "post:Pause"),
+			beego.NSRouter("/resume", adm, "post:Resume"),
+			beego.NSRouter("/apikeys", adm, "get:ListApiKeys"),
+			beego.NSRouter("/apikey", adm, "post:CreateApiKey"),
+			beego.NSRouter("/apikey/revoke", adm, "post:RevokeApiKey"),
+			beego.NSRouter("/report", adm, "get:Report"),
+			beego.NSRouter("/txs", adm, "get:Txs"),
+			beego.NSRouter("/replay", adm, "get,post:Replay"),
+			beego.NSRouter("/ledger", adm, "get:Ledger"),
+			beego.NSRouter("/events", adm, "get:Events"),
+			beego.NSRouter("/reconcile", adm, "get,post:Reconcile"),
+		))
+	} else {
+		log.Warn("jwtSecret not set, admin api disabled")
+	}
 	beego.AddNamespace(ns)
 }
-
@@ -0,0 +1,138 @@
+package alert
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hpb-project/srng-robot/config"
+	"github.com/hpb-project/srng-robot/log"
+)
+
+const (
+	KindLowBalance   = "low_balance"
+	KindRevealFailed = "reveal_failed"
+	KindCommitExpire = "commit_expired"
+	KindSyncLag      = "sync_lag"
+	KindRPCOutage    = "rpc_outage"
+	KindNonceStall   = "nonce_stall"
+	KindTest         = "test"
+
+	LevelWarn     = "warn"
+	LevelCritical = "critical"
+)
+
+type Alert struct {
+	Kind    string    `json:"kind"`
+	Level   string    `json:"level"`
+	Key     string    `json:"key"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+func (a Alert) Text() string {
+	return fmt.Sprintf("[%s] %s: %s\n%s", a.Level, a.Kind, a.Message, a.Time.Format(time.RFC3339))
+}
+
+// Manager deduplicates and rate limits alerts and hands them to the
+// configured notifiers in the background.
+type Manager struct {
+	mu    sync.Mutex
+	seen  map[string]time.Time
+	sent  []time.Time
+	queue chan Alert
+}
+
+func NewManager() *Manager {
+	m := &Manager{
+		seen:  make(map[string]time.Time),
+		queue: make(chan Alert, 100),
+	}
+	go m.loop()
+	return m
+}
+
+var (
+	defaultOnce    sync.Once
+	defaultManager *Manager
+)
+
+// manager returns the default manager, it is started on first use so that
+// importing the package doesn't start its loop.
+func manager() *Manager {
+	defaultOnce.Do(func() {
+		defaultManager = NewManager()
+	})
+	return defaultManager
+}
+
+// Fire raises an alert on the default manager. Alerts with the same kind
+// and key are sent once per dedup window.
+func Fire(kind string, level string, key string, format string, v ...interface{}) {
+	manager().Fire(kind, level, key, format, v...)
+}
+
+func (m *Manager) Fire(kind string, level string, key string, format string, v ...interface{}) {
+	a := Alert{Kind: kind, Level: level, Key: key, Message: fmt.Sprintf(format, v...), Time: time.Now()}
+	// a condition that holds for a while fires on every check, only the
+	// alerts that get through dedup are logged.
+	if !m.allow(a, config.Current().Alert) {
+		return
+	}
+	log.Warn("alert", "kind", a.Kind, "message", a.Message)
+	select {
+	case m.queue <- a:
+	default:
+		log.Error("alert queue full, drop alert", "kind", a.Kind)
+	}
+}
+
+func (m *Manager) allow(a Alert, conf config.AlertConfig) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := a.Kind + "/" + a.Key
+	if last, exist := m.seen[id]; exist && a.Time.Sub(last) < conf.Dedup {
+		return false
+	}
+	hourAgo := a.Time.Add(-time.Hour)
+	for len(m.sent) > 0 && m.sent[0].Before(hourAgo) {
+		m.sent = m.sent[1:]
+	}
+	if len(m.sent) >= conf.RateLimit {
+		log.Warn("alert rate limit reached, drop alert", "kind", a.Kind)
+		return false
+	}
+	for k, t := range m.seen {
+		if a.Time.Sub(t) >= conf.Dedup {
+			delete(m.seen, k)
+		}
+	}
+	m.seen[id] = a.Time
+	m.sent = append(m.sent, a.Time)
+	return true
+}
+
+func (m *Manager) loop() {
+	for a := range m.queue {
+		m.send(a)
+	}
+}
+
+func (m *Manager) send(a Alert) []error {
+	errs := make([]error, 0)
+	for _, n := range notifiers(config.Current().Alert) {
+		if err := n.Notify(a); err != nil {
+			log.Error("send alert failed", "notifier", n.Name(), "err", err)
+			errs = append(errs, fmt.Errorf("%s: %v", n.Name(), err))
+		}
+	}
+	return errs
+}
+
+// Test sends a test alert to every configured notifier right away, skipping
+// dedup and rate limit, and returns the delivery errors.
+func Test() (int, []error) {
+	a := Alert{Kind: KindTest, Level: LevelWarn, Key: "test", Message: "srng robot test alert", Time: time.Now()}
+	return len(notifiers(config.Current().Alert)), manager().send(a)
+}
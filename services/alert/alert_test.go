@@ -0,0 +1,228 @@
+package alert
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hpb-project/srng-robot/config"
+)
+
+// recorder is a local stand-in for webhook and chat endpoints.
+type recorder struct {
+	mu     sync.Mutex
+	status int
+	paths  []string
+	bodies []map[string]interface{}
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var body map[string]interface{}
+	json.NewDecoder(req.Body).Decode(&body)
+	r.mu.Lock()
+	r.paths = append(r.paths, req.URL.Path)
+	r.bodies = append(r.bodies, body)
+	status := r.status
+	r.mu.Unlock()
+	if status != 0 {
+		w.WriteHeader(status)
+	}
+}
+
+func (r *recorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.paths)
+}
+
+func testAlert() Alert {
+	return Alert{Kind: KindRevealFailed, Level: LevelCritical, Key: "0x01", Message: "reveal <b>failed</b>", Time: time.Now()}
+}
+
+func TestNotifiers(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		notifier Notifier
+		path     string
+		field    string
+	}{
+		{"webhook", &WebhookNotifier{url: srv.URL + "/hook"}, "/hook", "message"},
+		{"slack", &SlackNotifier{url: srv.URL + "/slack"}, "/slack", "text"},
+		{"telegram", &TelegramNotifier{api: srv.URL + "/", token: "123:abc", chat: "42"}, "/bot123:abc/sendMessage", "text"},
+	}
+	for i, tt := range tests {
+		if err := tt.notifier.Notify(testAlert()); err != nil {
+			t.Fatalf("%s: notify failed: %v", tt.name, err)
+		}
+		if rec.paths[i] != tt.path {
+			t.Errorf("%s: posted to %s, want %s", tt.name, rec.paths[i], tt.path)
+		}
+		if text, _ := rec.bodies[i][tt.field].(string); !strings.Contains(text, "reveal <b>failed</b>") {
+			t.Errorf("%s: %s is %q", tt.name, tt.field, text)
+		}
+	}
+	if chat := rec.bodies[2]["chat_id"]; chat != "42" {
+		t.Errorf("telegram chat_id is %v", chat)
+	}
+}
+
+func TestTelegramRedactsToken(t *testing.T) {
+	rec := &recorder{status: http.StatusInternalServerError}
+	srv := httptest.NewServer(rec)
+	n := &TelegramNotifier{api: srv.URL, token: "123:secret", chat: "42"}
+	err := n.Notify(testAlert())
+	if err == nil || strings.Contains(err.Error(), "123:secret") {
+		t.Errorf("bad status error %v", err)
+	}
+
+	srv.Close()
+	err = n.Notify(testAlert())
+	if err == nil || strings.Contains(err.Error(), "123:secret") {
+		t.Errorf("unreachable api error %v", err)
+	}
+}
+
+func TestMailBodyEscaped(t *testing.T) {
+	body := mailBody(testAlert())
+	if strings.Contains(body, "<b>") || !strings.Contains(body, "&lt;b&gt;") || !strings.Contains(body, "<br>") {
+		t.Errorf("mail body %q", body)
+	}
+}
+
+func TestManagerDedup(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+	config.Apply(func(conf *config.Config) {
+		conf.Alert.Webhook = srv.URL
+		conf.Alert.Dedup = time.Hour
+		conf.Alert.RateLimit = 2
+	})
+
+	m := NewManager()
+	m.Fire(KindSyncLag, LevelWarn, "sync", "behind %d", 1)
+	m.Fire(KindSyncLag, LevelWarn, "sync", "behind %d", 2)
+	m.Fire(KindRPCOutage, LevelCritical, "rpc", "down")
+	m.Fire(KindLowBalance, LevelWarn, "hpb", "over the rate limit")
+
+	deadline := time.Now().Add(time.Second * 5)
+	for rec.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	time.Sleep(time.Millisecond * 100)
+	if n := rec.count(); n != 2 {
+		t.Fatalf("sent %d alerts, want 2", n)
+	}
+	if kind := rec.bodies[0]["kind"]; kind != KindSyncLag {
+		t.Errorf("first alert is %v", kind)
+	}
+	if kind := rec.bodies[1]["kind"]; kind != KindRPCOutage {
+		t.Errorf("second alert is %v", kind)
+	}
+}
+
+// smtpServer is a local smtp server that accepts every mail without auth
+// or tls and records the data of each.
+type smtpServer struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	rcpts []string
+	mails []string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	c := textproto.NewConn(conn)
+	c.PrintfLine("220 localhost ready")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			c.PrintfLine("250 localhost")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			s.mu.Unlock()
+			c.PrintfLine("250 ok")
+		case cmd == "DATA":
+			c.PrintfLine("354 go ahead")
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.mails = append(s.mails, string(data))
+			s.mu.Unlock()
+			c.PrintfLine("250 queued")
+		case cmd == "QUIT":
+			c.PrintfLine("221 bye")
+			return
+		default:
+			c.PrintfLine("250 ok")
+		}
+	}
+}
+
+func TestMailNotifier(t *testing.T) {
+	srv := newSMTPServer(t)
+	defer srv.ln.Close()
+	addr := srv.ln.Addr().(*net.TCPAddr)
+
+	n := &MailNotifier{conf: config.AlertConfig{MailHost: "127.0.0.1", MailPort: addr.Port,
+		MailUser: "robot@example.com", MailTo: "ops@example.com"}}
+	if err := n.Notify(testAlert()); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.mails) != 1 {
+		t.Fatalf("got %d mails, want 1", len(srv.mails))
+	}
+	if len(srv.rcpts) != 1 || srv.rcpts[0] != "ops@example.com" {
+		t.Errorf("mail sent to %v", srv.rcpts)
+	}
+	mail := srv.mails[0]
+	for _, want := range []string{"Subject: [srng-robot] critical reveal_failed", "&lt;b&gt;failed&lt;/b&gt;"} {
+		if !strings.Contains(mail, want) {
+			t.Errorf("mail has no %q:\n%s", want, mail)
+		}
+	}
+
+	srv.ln.Close()
+	if err := n.Notify(testAlert()); err == nil {
+		t.Error("notify to a closed server succeeded")
+	}
+}
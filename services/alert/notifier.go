@@ -0,0 +1,117 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hpb-project/srng-robot/config"
+	"github.com/hpb-project/srng-robot/utils"
+)
+
+// Notifier delivers an alert to one target.
+type Notifier interface {
+	Name() string
+	Notify(a Alert) error
+}
+
+var httpClient = &http.Client{Timeout: time.Second * 10}
+
+func postJSON(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("post %s got status %s", url, resp.Status)
+	}
+	return nil
+}
+
+// MailNotifier sends alerts by smtp.
+type MailNotifier struct {
+	conf config.AlertConfig
+}
+
+func (n *MailNotifier) Name() string { return "mail" }
+
+func (n *MailNotifier) Notify(a Alert) error {
+	subject := fmt.Sprintf("[srng-robot] %s %s", a.Level, a.Kind)
+	return utils.SendMail(n.conf.MailUser, n.conf.MailPassword, n.conf.MailHost, n.conf.MailTo, subject, mailBody(a),
+		"srng-robot", n.conf.MailPort)
+}
+
+// mailBody is the html body of a, alert messages carry rpc errors and other
+// text from outside.
+func mailBody(a Alert) string {
+	return strings.ReplaceAll(html.EscapeString(a.Text()), "\n", "<br>")
+}
+
+// WebhookNotifier posts the alert as json to a generic http endpoint.
+type WebhookNotifier struct {
+	url string
+}
+
+func (n *WebhookNotifier) Name() string { return "webhook" }
+
+func (n *WebhookNotifier) Notify(a Alert) error {
+	return postJSON(n.url, a)
+}
+
+// SlackNotifier posts to a slack compatible incoming webhook.
+type SlackNotifier struct {
+	url string
+}
+
+func (n *SlackNotifier) Name() string { return "slack" }
+
+func (n *SlackNotifier) Notify(a Alert) error {
+	return postJSON(n.url, map[string]string{"text": a.Text()})
+}
+
+// TelegramNotifier sends the alert through a telegram bot.
+type TelegramNotifier struct {
+	api   string
+	token string
+	chat  string
+}
+
+func (n *TelegramNotifier) Name() string { return "telegram" }
+
+func (n *TelegramNotifier) Notify(a Alert) error {
+	url := fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimRight(n.api, "/"), n.token)
+	err := postJSON(url, map[string]string{"chat_id": n.chat, "text": a.Text()})
+	if err != nil && n.token != "" {
+		// the bot token is part of the url, keep it out of logs.
+		return errors.New(strings.ReplaceAll(err.Error(), n.token, "<token>"))
+	}
+	return err
+}
+
+// notifiers builds the notifiers for every target set in conf.
+func notifiers(conf config.AlertConfig) []Notifier {
+	list := make([]Notifier, 0)
+	if conf.MailHost != "" && conf.MailTo != "" {
+		list = append(list, &MailNotifier{conf: conf})
+	}
+	if conf.Webhook != "" {
+		list = append(list, &WebhookNotifier{url: conf.Webhook})
+	}
+	if conf.SlackWebhook != "" {
+		list = append(list, &SlackNotifier{url: conf.SlackWebhook})
+	}
+	if conf.TelegramToken != "" && conf.TelegramChat != "" {
+		list = append(list, &TelegramNotifier{api: conf.TelegramAPI, token: conf.TelegramToken, chat: conf.TelegramChat})
+	}
+	return list
+}
@@ -0,0 +1,177 @@
+package apikey
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/utils"
+)
+
+const (
+	HeaderKey       = "X-Api-Key"
+	HeaderTimestamp = "X-Api-Timestamp"
+	HeaderNonce     = "X-Api-Nonce"
+	HeaderSignature = "X-Api-Signature"
+
+	// MaxClockSkew is how far the request timestamp may be off.
+	MaxClockSkew = time.Minute * 5
+
+	// maxNonceLen bounds the nonces kept in memory.
+	maxNonceLen = 64
+)
+
+var (
+	ErrUnknownKey   = errors.New("unknown api key")
+	ErrInvalidKey   = errors.New("invalid api key")
+	ErrBadTimestamp = errors.New("request timestamp out of range")
+	ErrBadNonce     = errors.New("missing or reused request nonce")
+	ErrBadSignature = errors.New("invalid request signature")
+)
+
+// Issue creates a new key and secret pair and stores it.
+func Issue(ldb db.Store, name string, rateLimit int) (db.ApiKey, error) {
+	key, secret, err := utils.CreateAppKeySecret(name)
+	if err != nil {
+		return db.ApiKey{}, err
+	}
+	k := db.ApiKey{Key: key, Secret: secret, Name: name, RateLimit: rateLimit, Created: time.Now().Unix()}
+	return k, db.SetApiKey(ldb, k)
+}
+
+// Revoke disables a key, it stays stored for the record.
+func Revoke(ldb db.Store, key string) error {
+	k, exist := db.GetApiKey(ldb, key)
+	if !exist {
+		return ErrUnknownKey
+	}
+	if k.Revoked == 0 {
+		k.Revoked = time.Now().Unix()
+	}
+	return db.SetApiKey(ldb, k)
+}
+
+// Sign returns the signature of a request, the hex hmac-sha256 with the
+// secret over method, path, raw query, timestamp and nonce joined by
+// newlines.
+func Sign(secret string, method string, path string, query string, timestamp string, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{strings.ToUpper(method), path, query, timestamp, nonce}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signed request and returns the key it was signed with.
+// Unknown and revoked keys fail alike, a caller can't probe which keys
+// exist. The nonce is only checked for presence, see Nonces.
+func Verify(ldb db.Store, key string, method string, path string, query string, timestamp string, nonce string,
+	signature string) (db.ApiKey, error) {
+	k, exist := db.GetApiKey(ldb, key)
+	if !exist || k.Revoked != 0 {
+		return db.ApiKey{}, ErrInvalidKey
+	}
+	if nonce == "" || len(nonce) > maxNonceLen {
+		return k, ErrBadNonce
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return k, ErrBadTimestamp
+	}
+	if skew := time.Since(time.Unix(ts, 0)); skew > MaxClockSkew || skew < -MaxClockSkew {
+		return k, ErrBadTimestamp
+	}
+	expect := Sign(k.Secret, method, path, query, timestamp, nonce)
+	if !hmac.Equal([]byte(expect), []byte(strings.ToLower(signature))) {
+		return k, ErrBadSignature
+	}
+	return k, nil
+}
+
+// Nonces remembers the nonces of verified requests while their timestamp is
+// accepted, so a signed request can't be sent again.
+type Nonces struct {
+	mu     sync.Mutex
+	seen   map[string]time.Time
+	pruned time.Time
+}
+
+func NewNonces() *Nonces {
+	return &Nonces{seen: make(map[string]time.Time), pruned: time.Now()}
+}
+
+// Use records nonce for key and reports false if it was used before.
+func (n *Nonces) Use(key string, nonce string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(n.pruned) > time.Minute {
+		for id, expires := range n.seen {
+			if now.After(expires) {
+				delete(n.seen, id)
+			}
+		}
+		n.pruned = now
+	}
+	id := key + "\n" + nonce
+	if expires, exist := n.seen[id]; exist && !now.After(expires) {
+		return false
+	}
+	// a timestamp is accepted from MaxClockSkew ahead to MaxClockSkew behind.
+	n.seen[id] = now.Add(MaxClockSkew * 2)
+	return true
+}
+
+// Limiter is a per key token bucket refilled every minute.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	pruned  time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{buckets: make(map[string]*bucket), pruned: time.Now()}
+}
+
+// Allow takes one token from the bucket of key, perMinute is the bucket
+// size and refill rate.
+func (l *Limiter) Allow(key string, perMinute int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.pruned) > time.Minute {
+		// a bucket idle for a minute is full again, same as a new one.
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > time.Minute {
+				delete(l.buckets, k)
+			}
+		}
+		l.pruned = now
+	}
+	b, exist := l.buckets[key]
+	if !exist {
+		b = &bucket{tokens: float64(perMinute), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Minutes() * float64(perMinute)
+	if b.tokens > float64(perMinute) {
+		b.tokens = float64(perMinute)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
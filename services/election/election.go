@@ -0,0 +1,137 @@
+package election
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hpb-project/srng-robot/config"
+	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/log"
+)
+
+const (
+	ModeNone     = "none"
+	ModeLease    = "lease"
+	ModeFileLock = "filelock"
+)
+
+// Elector decides which of several robot instances may sign transactions.
+type Elector interface {
+	// Campaign takes or renews leadership and reports whether this
+	// instance leads until the next call.
+	Campaign() (bool, error)
+
+	// Resign gives up leadership so a standby can take over at once.
+	Resign() error
+}
+
+// Election runs an Elector periodically and tracks the result. Without an
+// elector the instance always leads, which is the single robot setup.
+type Election struct {
+	elector  Elector
+	interval time.Duration
+	leading  int32
+	onChange func(leader bool)
+}
+
+// CheckMode rejects an ha mode the store can't be shared in. leveldb is
+// opened by one process only, so instances need a sqlite file or postgres.
+func CheckMode(conf config.Config) error {
+	switch strings.ToLower(conf.HAMode) {
+	case "", ModeNone:
+		return nil
+	case ModeLease, ModeFileLock:
+		switch strings.ToLower(conf.DBDriver) {
+		case db.DriverSQLite, db.DriverPostgres:
+			return nil
+		}
+		return fmt.Errorf("ha mode %s needs dbDriver %s or %s, %s can't be shared", conf.HAMode,
+			db.DriverSQLite, db.DriverPostgres, conf.DBDriver)
+	default:
+		return fmt.Errorf("unknown ha mode %s", conf.HAMode)
+	}
+}
+
+func NewElection(conf config.Config, ldb db.Store) (*Election, error) {
+	if err := CheckMode(conf); err != nil {
+		return nil, err
+	}
+	e := &Election{interval: conf.HALeaseTTL / 3}
+	switch strings.ToLower(conf.HAMode) {
+	case "", ModeNone:
+		e.leading = 1
+	case ModeLease:
+		e.elector = NewStoreLease(ldb, nodeId(conf), conf.HALeaseTTL)
+	case ModeFileLock:
+		e.elector = NewFileLock(conf.HALockFile)
+	}
+	if e.interval <= 0 {
+		e.interval = time.Second
+	}
+	return e, nil
+}
+
+func nodeId(conf config.Config) string {
+	if conf.HANodeId != "" {
+		return conf.HANodeId
+	}
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// IsLeader reports whether this instance may commit and reveal now.
+func (e *Election) IsLeader() bool {
+	return atomic.LoadInt32(&e.leading) == 1
+}
+
+// OnChange registers fn to be called whenever leadership is won or lost.
+func (e *Election) OnChange(fn func(leader bool)) {
+	e.onChange = fn
+}
+
+func (e *Election) setLeader(leader bool) {
+	var v int32
+	if leader {
+		v = 1
+	}
+	if atomic.SwapInt32(&e.leading, v) == v {
+		return
+	}
+	if leader {
+		log.Info("became leader")
+	} else {
+		log.Warn("lost leadership, switch to standby")
+	}
+	if e.onChange != nil {
+		e.onChange(leader)
+	}
+}
+
+// Run campaigns until stop is closed, then resigns.
+func (e *Election) Run(stop chan struct{}) {
+	if e.elector == nil {
+		return
+	}
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		leader, err := e.elector.Campaign()
+		if err != nil {
+			log.Error("leader campaign failed", "err", err)
+		}
+		e.setLeader(leader)
+
+		select {
+		case <-stop:
+			e.setLeader(false)
+			if err := e.elector.Resign(); err != nil {
+				log.Error("resign leadership failed", "err", err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
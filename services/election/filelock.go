@@ -0,0 +1,50 @@
+//go:build !windows
+// +build !windows
+
+package election
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileLock elects the leader with an exclusive lock on a file, for several
+// instances on one host. The lock is released by the kernel when the leader
+// dies, so a standby takes over on its next campaign.
+type FileLock struct {
+	path string
+	file *os.File
+}
+
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+func (l *FileLock) Campaign() (bool, error) {
+	if l.file != nil {
+		return true, nil
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return false, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return false, nil
+		}
+		return false, err
+	}
+	l.file = f
+	return true, nil
+}
+
+func (l *FileLock) Resign() error {
+	if l.file == nil {
+		return nil
+	}
+	syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
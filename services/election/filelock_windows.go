@@ -0,0 +1,18 @@
+package election
+
+import "errors"
+
+// FileLock is not supported on windows, use the lease mode instead.
+type FileLock struct{}
+
+func NewFileLock(path string) *FileLock {
+	return &FileLock{}
+}
+
+func (l *FileLock) Campaign() (bool, error) {
+	return false, errors.New("filelock ha mode is not supported on windows")
+}
+
+func (l *FileLock) Resign() error {
+	return nil
+}
@@ -0,0 +1,72 @@
+package election
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hpb-project/srng-robot/db"
+)
+
+const leaseKey = "haLeaderLease"
+
+type lease struct {
+	Owner   string `json:"owner"`
+	Expires int64  `json:"expires"`
+}
+
+// StoreLease elects the leader through a lease record in a store shared by
+// all instances, such as postgres. The leader renews the lease, a standby
+// takes it over once it has expired.
+type StoreLease struct {
+	ldb     db.Store
+	id      string
+	ttl     time.Duration
+	expires time.Time
+}
+
+func NewStoreLease(ldb db.Store, id string, ttl time.Duration) *StoreLease {
+	return &StoreLease{ldb: ldb, id: id, ttl: ttl}
+}
+
+func (l *StoreLease) Campaign() (bool, error) {
+	now := time.Now()
+	next, _ := json.Marshal(lease{Owner: l.id, Expires: now.Add(l.ttl).UnixNano()})
+
+	cur, exist, err := l.ldb.Get([]byte(leaseKey))
+	if err != nil {
+		return now.Before(l.expires), err
+	}
+	if exist {
+		var held lease
+		if err := json.Unmarshal(cur, &held); err == nil && held.Owner != l.id && held.Expires > now.UnixNano() {
+			return false, nil
+		}
+	} else {
+		cur = nil
+	}
+	ok, err := l.ldb.CompareAndSwap([]byte(leaseKey), cur, next)
+	if err != nil {
+		// keep leading while our last lease is valid, no one else can
+		// take it before it expires.
+		return now.Before(l.expires), err
+	}
+	if ok {
+		l.expires = now.Add(l.ttl)
+	}
+	return ok, nil
+}
+
+func (l *StoreLease) Resign() error {
+	cur, exist, err := l.ldb.Get([]byte(leaseKey))
+	if err != nil || !exist {
+		return err
+	}
+	var held lease
+	if err := json.Unmarshal(cur, &held); err != nil || held.Owner != l.id {
+		return nil
+	}
+	released, _ := json.Marshal(lease{Owner: l.id})
+	_, err = l.ldb.CompareAndSwap([]byte(leaseKey), cur, released)
+	l.expires = time.Time{}
+	return err
+}
@@ -0,0 +1,96 @@
+// Package indexer keeps every oracle event of every committer in the store,
+// so the whole market can be queried and consumers' requests traced.
+package indexer
+
+import (
+	"encoding/hex"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hpb-project/srng-robot/contracts"
+	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/services/pullevent"
+)
+
+type indexer struct {
+	filter *contracts.OracleFilterer
+}
+
+// Register adds the index handlers for the oracle at addr to r, the oracle
+// has to be added to r already.
+func Register(r *pullevent.Registry, addr common.Address, backend bind.ContractFilterer) error {
+	filter, err := contracts.NewOracleFilterer(addr, backend)
+	if err != nil {
+		return err
+	}
+	x := &indexer{filter: filter}
+	for _, reg := range []struct {
+		event   string
+		handler pullevent.EventHandler
+	}{
+		{"CommitHash", x.commitHash},
+		{"Subscribe", x.subscribe},
+		{"UnSubscribe", x.unSubscribe},
+		{"RevealSeed", x.revealSeed},
+		{"RandomConsumed", x.randomConsumed},
+	} {
+		if err := r.Register("indexer."+reg.event, addr, reg.event, pullevent.PolicyBlock, reg.handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func event(name string, l types.Log, hash [32]byte, committer common.Address, time uint64) db.OracleEvent {
+	return db.OracleEvent{Event: name, Block: l.BlockNumber, LogIndex: l.Index, TxHash: l.TxHash.Hex(),
+		Hash: common.Hash(hash).Hex(), Committer: committer.Hex(), Time: time}
+}
+
+func (x *indexer) commitHash(l types.Log, pe *pullevent.PullEvent, b db.Batch, history bool) error {
+	ev, err := x.filter.ParseCommitHash(l)
+	if err != nil {
+		return err
+	}
+	return db.SetOracleEvent(b, event("CommitHash", l, ev.Hash, ev.Sender, ev.Time.Uint64()))
+}
+
+func (x *indexer) subscribe(l types.Log, pe *pullevent.PullEvent, b db.Batch, history bool) error {
+	ev, err := x.filter.ParseSubscribe(l)
+	if err != nil {
+		return err
+	}
+	e := event("Subscribe", l, ev.Hash, ev.Commiter, ev.Time.Uint64())
+	e.Consumer = ev.Consumer.Hex()
+	return db.SetOracleEvent(b, e)
+}
+
+func (x *indexer) unSubscribe(l types.Log, pe *pullevent.PullEvent, b db.Batch, history bool) error {
+	ev, err := x.filter.ParseUnSubscribe(l)
+	if err != nil {
+		return err
+	}
+	e := event("UnSubscribe", l, ev.Hash, ev.Commiter, ev.Time.Uint64())
+	e.Consumer = ev.Consumer.Hex()
+	return db.SetOracleEvent(b, e)
+}
+
+func (x *indexer) revealSeed(l types.Log, pe *pullevent.PullEvent, b db.Batch, history bool) error {
+	ev, err := x.filter.ParseRevealSeed(l)
+	if err != nil {
+		return err
+	}
+	e := event("RevealSeed", l, ev.Hash, ev.Commiter, ev.Time.Uint64())
+	e.Seed = "0x" + hex.EncodeToString(ev.Seed[:])
+	return db.SetOracleEvent(b, e)
+}
+
+func (x *indexer) randomConsumed(l types.Log, pe *pullevent.PullEvent, b db.Batch, history bool) error {
+	ev, err := x.filter.ParseRandomConsumed(l)
+	if err != nil {
+		return err
+	}
+	e := event("RandomConsumed", l, ev.Hash, ev.Commiter, ev.Time.Uint64())
+	e.Consumer = ev.Consumer.Hex()
+	return db.SetOracleEvent(b, e)
+}
@@ -1,20 +1,23 @@
 package monitor
 
 import (
+	"bytes"
 	"context"
 	"crypto/ecdsa"
 	"encoding/hex"
 	"errors"
-	"github.com/astaxie/beego"
-	"github.com/astaxie/beego/logs"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/hpb-project/srng-robot/config"
 	"github.com/hpb-project/srng-robot/contracts"
 	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/log"
+	"github.com/hpb-project/srng-robot/services/alert"
 	"github.com/hpb-project/srng-robot/utils"
 	"golang.org/x/crypto/sha3"
 	"math/big"
@@ -24,7 +27,8 @@ import (
 
 type MonitorService struct {
 	ctx context.Context
-	ldb *db.LevelDB
+	cancel context.CancelFunc
+	ldb db.Store
 	client *ethclient.Client
 	signer types.Signer
 	privk *ecdsa.PrivateKey
@@ -36,34 +40,51 @@ type MonitorService struct {
 	user common.Address
 	callopt  *bind.CallOpts
 
-	waitmux sync.Mutex
-	waittoreveal [][]byte
+	queue   *revealQueue
+	watcher *txWatcher
+	sendmux sync.Mutex
 
-	revealTask chan []byte
+	isLeader    func() bool
+	approveOnce sync.Once
+
+	chainNonce   uint64
+	chainNonceAt time.Time
+
+	reconcileMux  sync.Mutex
+	lastReconcile *db.ReconcileReport
 }
 const (
 	MAX_UNVERIFY_BLOCK = 400 // todo: change to read from config contract.
 )
 
-func NewMonitorService(config config.Config, ldb *db.LevelDB)  (*MonitorService,error) {
-	ctx := context.Background()
-	client, err := ethclient.Dial(config.NodeRPC)
+// purposes of the txs in the audit log.
+const (
+	TxApprove = "approve"
+	TxCommit  = "commit"
+	TxReveal  = "reveal"
+)
+
+func NewMonitorService(config config.Config, ldb db.Store)  (*MonitorService,error) {
+	rpcClient, err := rpc.DialContext(context.Background(), config.NodeRPC)
 	if err != nil {
 		return nil, err
 	}
+	client := ethclient.NewClient(rpcClient)
 	oracleAddr := common.HexToAddress(config.Oracle)
 	oracle, err := contracts.NewOracle(oracleAddr, client)
 	if err != nil {
-		logs.Error("create oracle contract failed", "err", err)
+		log.Error("create oracle contract failed", "err", err)
 		return nil, err
 	}
 
 	key,err := crypto.HexToECDSA(config.PrivKey)
 	if err != nil {
-		logs.Error("invalid private key")
+		log.Error("invalid private key")
 		return nil, err
 	}
 
+	// canceled when Run stops.
+	ctx, cancel := context.WithCancel(context.Background())
 	keyAddr := utils.PrivkToAddress(config.PrivKey)
 	signer := types.LatestSignerForChainID(big.NewInt(int64(config.ChainId)))
 
@@ -76,11 +97,12 @@ func NewMonitorService(config config.Config, ldb *db.LevelDB)  (*MonitorService,
 
 	nonce,err := client.NonceAt(ctx, keyAddr, nil)
 	if err != nil {
-		logs.Error("can't get user nonce", "err", err)
+		log.Error("can't get user nonce", "err", err)
 	}
 
 	product := &MonitorService{
 		ctx:ctx,
+		cancel:cancel,
 		oracleContract: oracle,
 		ldb: ldb,
 		user: keyAddr,
@@ -90,21 +112,111 @@ func NewMonitorService(config config.Config, ldb *db.LevelDB)  (*MonitorService,
 		signer: signer,
 		privk: key,
 		nonce: nonce,
-		waittoreveal: make([][]byte,0),
-		revealTask: make(chan []byte, 1000),
+		queue: newRevealQueue(ldb),
+		watcher: newTxWatcher(rpcClient, ldb),
+		isLeader: func() bool { return true },
 	}
-	logs.Info("create monitor succeed")
-	product.approvetoken(big.NewInt(10000000000))
-	logs.Info("token approve finished")
+	log.Info("create monitor succeed")
 	return product, nil
 }
 
+// SetLeaderCheck makes the service commit and reveal only while leader
+// returns true, a standby keeps its queue and picks it up on takeover.
+func (s *MonitorService) SetLeaderCheck(leader func() bool) {
+	s.isLeader = leader
+}
+
+// Approve approves the oracle to spend our token again.
+func (s *MonitorService) Approve() error {
+	return s.approvetoken(big.NewInt(10000000000))
+}
+
+// ForceReveal queues a reveal for commit even if it was already marked
+// revealed locally, the seed must be known.
+func (s *MonitorService) ForceReveal(commit []byte) error {
+	if _, exist := db.GetSeedBySeedHash(s.ldb, commit); !exist {
+		return errors.New("seed of commit not found")
+	}
+	if err := db.SetUnRevealSeed(s.ldb, commit); err != nil {
+		return err
+	}
+	s.DoReveal(commit)
+	return nil
+}
+
+// unverified reports whether commit is still waiting for its reveal on
+// chain, errors count as waiting.
+func (s *MonitorService) unverified(commit []byte) bool {
+	list, err := s.oracleContract.GetUserUnverifiedList(s.callopt, s.user)
+	if err != nil {
+		log.Error("can't get user unverified list", "err", err)
+		return true
+	}
+	for _, c := range list {
+		if bytes.Equal(c.Commit[:], commit) {
+			return true
+		}
+	}
+	return false
+}
+
+// PendingTxs returns the number of sent txs waiting for their receipt.
+func (s *MonitorService) PendingTxs() int {
+	return s.watcher.len()
+}
+
+// RevealQueue returns the number of queued reveals.
+func (s *MonitorService) RevealQueue() int {
+	return s.queue.len()
+}
+
+// deadline is the last block the reveal of commit is accepted in, 0 when
+// the commit block isn't synced yet.
+func (s *MonitorService) deadline(commit []byte) uint64 {
+	if l, exist := db.GetLifecycle(s.ldb, commit); exist {
+		return l.CommitBlock + MAX_UNVERIFY_BLOCK
+	}
+	return 0
+}
+
+// Nonce returns the next local nonce.
+func (s *MonitorService) Nonce() uint64 {
+	s.muxnonce.Lock()
+	defer s.muxnonce.Unlock()
+	return s.nonce
+}
+
+// User returns the committer address.
+func (s *MonitorService) User() common.Address {
+	return s.user
+}
+
+// canCommit reports whether new commits may be sent now.
+func (s *MonitorService) canCommit() bool {
+	return s.isLeader() && db.GetPauseState(s.ldb) == db.PauseNone
+}
+
+// canReveal reports whether reveals may be sent now.
+func (s *MonitorService) canReveal() bool {
+	return s.isLeader() && db.GetPauseState(s.ldb) != db.PauseAll
+}
+
+// ensureApproved approves the oracle to spend our token the first time this
+// instance leads.
+func (s *MonitorService) ensureApproved() {
+	s.approveOnce.Do(func() {
+		s.approvetoken(big.NewInt(10000000000))
+		log.Info("token approve finished")
+	})
+}
+
 func (s *MonitorService)getnonce() uint64 {
 	s.muxnonce.Lock()
 	defer s.muxnonce.Unlock()
 	var result uint64
 	chain,_ := s.client.NonceAt(s.ctx, s.user, nil)
-	logs.Info("on chain nonce is", chain, "local nonce is", s.nonce)
+	log.Info("sync nonce", "chain", chain, "local", s.nonce)
+	s.checkNonceStall(chain)
 	if chain > s.nonce {
 		result = chain
 		s.nonce = chain + 1
@@ -112,10 +224,64 @@ func (s *MonitorService)getnonce() uint64 {
 		result = s.nonce
 		s.nonce += 1
 	}
-	logs.Info("get nonce", result)
+	log.Debug("get nonce", log.FieldNonce, result)
 	return result
 }
 
+// ResetNonce reloads the local nonce from the pending state of the chain,
+// used after a takeover where another instance sent with the same key.
+func (s *MonitorService) ResetNonce() {
+	s.muxnonce.Lock()
+	defer s.muxnonce.Unlock()
+	nonce, err := s.client.PendingNonceAt(s.ctx, s.user)
+	if err != nil {
+		log.Error("can't get user pending nonce", "err", err)
+		return
+	}
+	s.nonce = nonce
+	log.Info("reset nonce", log.FieldNonce, nonce)
+}
+
+// checkNonceStall alerts when we have sent transactions but the on chain
+// nonce didn't move for a while, the pending ones are probably stuck.
+func (s *MonitorService) checkNonceStall(chain uint64) {
+	now := time.Now()
+	if chain != s.chainNonce || s.chainNonceAt.IsZero() {
+		s.chainNonce = chain
+		s.chainNonceAt = now
+		return
+	}
+	stall := config.Current().Alert.NonceStall
+	if s.nonce > chain && now.Sub(s.chainNonceAt) > stall {
+		alert.Fire(alert.KindNonceStall, alert.LevelCritical, s.user.Hex(),
+			"nonce %d not mined for %s, local nonce is %d", chain, now.Sub(s.chainNonceAt).Round(time.Second), s.nonce)
+	}
+}
+
+// checkBalance alerts when the HPB for gas or the HRG for deposits runs low.
+func (s *MonitorService) checkBalance() {
+	conf := config.Current().Alert
+	balance, err := s.client.BalanceAt(s.ctx, s.user, nil)
+	if err != nil {
+		log.Error("get balance failed", "err", err)
+	} else if conf.MinBalance != nil && balance.Cmp(conf.MinBalance) < 0 {
+		alert.Fire(alert.KindLowBalance, alert.LevelCritical, "hpb", "HPB balance of %s is %s wei, below %s",
+			s.user.Hex(), balance, conf.MinBalance)
+	}
+
+	token, err := contracts.NewToken(common.HexToAddress(s.conf.Token), s.client)
+	if err != nil {
+		return
+	}
+	tokenBalance, err := token.BalanceOf(s.callopt, s.user)
+	if err != nil {
+		log.Error("get token balance failed", "err", err)
+	} else if conf.MinTokenBalance != nil && tokenBalance.Cmp(conf.MinTokenBalance) < 0 {
+		alert.Fire(alert.KindLowBalance, alert.LevelCritical, "hrg", "HRG balance of %s is %s wei, below %s",
+			s.user.Hex(), tokenBalance, conf.MinTokenBalance)
+	}
+}
+
 func (s *MonitorService)getTransopt() *bind.TransactOpts {
 	transopt := &bind.TransactOpts{
 		From: s.user,
@@ -131,91 +297,158 @@ func (s *MonitorService)getTransopt() *bind.TransactOpts {
 		},
 		Nonce: new(big.Int).SetUint64(s.getnonce()),
 	}
-	transopt.GasPrice,_ = new(big.Int).SetString("5000000000", 10)
-	transopt.GasLimit = 1000000
+	runtime := config.Current()
+	transopt.GasPrice = new(big.Int).Set(runtime.GasPrice)
+	transopt.GasLimit = runtime.GasLimit
 
 	return transopt
 }
 
+// sendtx signs a tx through send, simulates it against the pending state
+// and broadcasts it unless it would revert. The signed tx and the broadcast
+// result go to the tx audit log.
+func (s *MonitorService) sendtx(purpose string, commit []byte, send func(opts *bind.TransactOpts) (*types.Transaction, error)) (*types.Transaction, error) {
+	// sends are serialized so nonces go out in order, receipts are waited
+	// for by the watcher.
+	s.sendmux.Lock()
+	defer s.sendmux.Unlock()
+	opts := s.getTransopt()
+	opts.NoSend = true
+	var signed *types.Transaction
+	sign := opts.Signer
+	opts.Signer = func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+		tx, err := sign(address, tx)
+		if err != nil {
+			return nil, err
+		}
+		signed = tx
+		raw, _ := tx.MarshalBinary()
+		entry := db.AuditEntry{Event: db.AuditSigned, TxHash: tx.Hash().Hex(), Purpose: purpose, Nonce: tx.Nonce(),
+			GasPrice: tx.GasPrice().String(), GasLimit: tx.Gas(), RawTx: hexutil.Encode(raw)}
+		if commit != nil {
+			entry.Commit = common.BytesToHash(commit).Hex()
+		}
+		if err := db.AppendTxAudit(s.ldb, entry); err != nil {
+			log.Error("write tx audit failed", log.FieldTx, tx.Hash(), "err", err)
+		}
+		return tx, nil
+	}
+	tx, err := send(opts)
+	if err == nil {
+		if err = simulate(s.ctx, s.client, tx); err == nil {
+			err = s.client.SendTransaction(s.ctx, tx)
+		} else {
+			log.Warn("tx would revert, not sent", "purpose", purpose, log.FieldTx, tx.Hash(), "err", err)
+		}
+	}
+	if signed != nil {
+		entry := db.AuditEntry{Event: db.AuditBroadcast, TxHash: signed.Hash().Hex()}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		if err := db.AppendTxAudit(s.ldb, entry); err != nil {
+			log.Error("write tx audit failed", log.FieldTx, signed.Hash(), "err", err)
+		}
+	}
+	if err != nil {
+		// the nonce was not used, take the next one from the node again so
+		// the following txs don't queue behind a gap.
+		s.ResetNonce()
+	}
+	return tx, err
+}
+
 func (s *MonitorService)approvetoken(amount *big.Int) error {
 	var unit,_ = new(big.Int).SetString("1000000000000000000", 10)
 	token,err := contracts.NewToken(common.HexToAddress(s.conf.Token), s.client)
 	if err != nil {
-		logs.Error("create token contracts failed", "err", err)
+		log.Error("create token contracts failed", "err", err)
 		return err
 	}
-	tx,err := token.Approve(s.getTransopt(), common.HexToAddress(s.conf.Oracle), new(big.Int).Mul(amount, unit))
+	tx,err := s.sendtx(TxApprove, nil, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return token.Approve(opts, common.HexToAddress(s.conf.Oracle), new(big.Int).Mul(amount, unit))
+	})
 	if err != nil {
-		logs.Error("approve token failed", "err",err)
+		log.Error("approve token failed", "err",err)
 		return err
 	}
-	receipt := s.waittx(tx)
+	receipt := s.watcher.wait(tx)
 	if receipt != nil && receipt.Status == 1 {
-		logs.Info("approve token succeed")
+		log.Info("approve token succeed")
 		return nil
 	} else {
-		logs.Info("approve token failed")
+		log.Info("approve token failed")
 		return errors.New("approve token failed")
 	}
 }
 
-func (s *MonitorService) waittx(tx *types.Transaction) *types.Receipt {
-	ticker := time.NewTicker(time.Second*2)
-	timeout := time.NewTimer(time.Second*30)
-	logs.Debug("wait tx", "hash", tx.Hash())
-	defer ticker.Stop()
-	defer timeout.Stop()
-	for {
-		select {
-		case <-ticker.C:
-			r, err := s.client.TransactionReceipt(s.ctx, tx.Hash())
-			if err != nil || r == nil {
-				continue
-			}
-			return r
-
-		case <-timeout.C:
-			return nil
-		}
-	}
+// txFee is the HPB paid in gas by a mined tx.
+func txFee(tx *types.Transaction, receipt *types.Receipt) *big.Int {
+	return new(big.Int).Mul(tx.GasPrice(), new(big.Int).SetUint64(receipt.GasUsed))
 }
 
-func (s *MonitorService) doReveal(commit []byte, needcheck bool) bool {
+// sendReveal sends the reveal of job and returns once it is broadcast, the
+// job is finished by the receipt callback. done reports a job that needs
+// no reveal anymore.
+func (s *MonitorService) sendReveal(job db.RevealJob) (done bool, err error) {
 	var hash [32]byte
 	var seed [32]byte
+	commit := job.Commit
 
 	if !db.HasUnRevealSeed(s.ldb, commit) {
-		return true;
+		return true, nil
 	}
 
 	value,exist := db.GetSeedBySeedHash(s.ldb, commit)
 	if !exist {
-		logs.Error("can't doreveal because not found seed", "commit", hex.EncodeToString(commit))
-		return true
+		log.Error("can't doreveal because not found seed", log.FieldCommit, common.BytesToHash(commit))
+		return true, nil
 	}
 	copy(hash[:], commit[:])
 	copy(seed[:], value[:])
 
-	tx,err := s.oracleContract.Reveal(s.getTransopt(), hash, seed)
-	if err != nil {
-		logs.Error("tx reveal failed", "err", err)
-		return false
+	tx,err := s.sendtx(TxReveal, commit, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return s.oracleContract.Reveal(opts, hash, seed)
+	})
+	var revert *RevertError
+	if errors.As(err, &revert) {
+		writeFailed("save reveal error", commit, db.SetLifeError(s.ldb, commit, db.FeeReveal, revert.Reason))
+		if !s.unverified(commit) {
+			// already revealed, expired or not ours, sending it can only fail.
+			log.Warn("drop reveal that would revert", log.FieldCommit, common.Hash(hash), "reason", revert.Reason)
+			if err := db.DelUnRevealSeed(s.ldb, commit); err != nil {
+				// keep the job, the next attempt drops it again.
+				log.Error("drop unrevealed mark failed", log.FieldCommit, common.Hash(hash), "err", err)
+				return false, err
+			}
+			return true, nil
+		}
 	}
-	logs.Info("do reveal", "hash", hex.EncodeToString(hash[:]))
-	receipt := s.waittx(tx)
-	if receipt != nil && receipt.Status == 1 {
-		// successful
-		return true
-	} else {
-		return false
+	if err != nil {
+		log.Error("tx reveal failed", log.FieldCommit, common.Hash(hash), "err", err)
+		return false, err
 	}
-}
-
-func (s *MonitorService) AddToRevealAgain(commit []byte) {
-	s.waitmux.Lock()
-	defer s.waitmux.Unlock()
-
-	s.waittoreveal = append(s.waittoreveal, commit)
+	log.Info("do reveal", log.FieldCommit, common.Hash(hash), log.FieldTx, tx.Hash(), log.FieldNonce, tx.Nonce())
+	s.watcher.watch(tx, func(receipt *types.Receipt, revert string) {
+		if receipt != nil {
+			writeFailed("save reveal fee", commit, db.SetLifeFee(s.ldb, commit, db.FeeReveal, txFee(tx, receipt)))
+		}
+		if receipt != nil && receipt.Status == types.ReceiptStatusSuccessful {
+			// the RevealSeed event clears the mark too, once it is synced.
+			writeFailed("drop unrevealed mark", commit, db.DelUnRevealSeed(s.ldb, commit))
+			s.queue.done(commit)
+			return
+		}
+		reason := "reveal timeout"
+		if receipt != nil {
+			reason = "reveal reverted: " + revert
+			writeFailed("save reveal error", commit, db.SetLifeError(s.ldb, commit, db.FeeReveal, revert))
+		}
+		alert.Fire(alert.KindRevealFailed, alert.LevelCritical, hex.EncodeToString(commit),
+			"reveal of commit %s failed (%s), attempt %d, retry later", hex.EncodeToString(commit), reason, job.Attempts+1)
+		s.queue.retry(job, reason)
+	})
+	return false, nil
 }
 
 func (s *MonitorService) DoCommit() error {
@@ -223,27 +456,48 @@ func (s *MonitorService) DoCommit() error {
 	seed := sha3.Sum256(r)
 	seedHash,err := s.oracleContract.GetHash(s.callopt, seed)
 	if err != nil {
-		beego.Error("get seed hash failed", "err", err)
+		log.Error("get seed hash failed", "err", err)
+		return err
+	}
+	// without the seed the commit can never be revealed and its deposit is
+	// lost, so nothing is sent unless it is stored.
+	if err := db.SetSeedHashAndSeed(s.ldb, seedHash[:], seed[:]); err != nil {
+		log.Error("save seed failed", log.FieldCommit, common.Hash(seedHash), "err", err)
 		return err
 	}
-	db.SetSeedHashAndSeed(s.ldb, seedHash[:], seed[:])
 
-	tx,err := s.oracleContract.Commit(s.getTransopt(), seedHash)
+	tx,err := s.sendtx(TxCommit, seedHash[:], func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return s.oracleContract.Commit(opts, seedHash)
+	})
 	if err != nil {
-		logs.Error("commit seed hash failed", "err", err)
+		log.Error("commit seed hash failed", "err", err)
 		return err
 	}
-	logs.Info("do commit", "hash", hex.EncodeToString(seedHash[:]))
-	receipt := s.waittx(tx)
-	if receipt == nil || receipt.Status == 1 {
-		// wait timeout or commit succeed
-		db.SetUnRevealSeed(s.ldb, seedHash[:])
-	}
-	return nil
+	log.Info("do commit", log.FieldCommit, common.Hash(seedHash), log.FieldTx, tx.Hash(), log.FieldNonce, tx.Nonce())
+	// mark it committed right away, a subscribe may arrive before the
+	// receipt is seen. a reverted commit is taken back by the callback.
+	err = s.ldb.Update(func(b db.Batch) error {
+		return db.SetCommitted(b, seedHash[:], tx.Hash().Bytes())
+	})
+	s.watcher.watch(tx, func(receipt *types.Receipt, revert string) {
+		if receipt == nil {
+			return
+		}
+		writeFailed("save commit fee", seedHash[:], db.SetLifeFee(s.ldb, seedHash[:], db.FeeCommit, txFee(tx, receipt)))
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			log.Warn("commit reverted", log.FieldCommit, common.Hash(seedHash), log.FieldTx, tx.Hash(), "reason", revert)
+			writeFailed("save commit error", seedHash[:], db.SetLifeError(s.ldb, seedHash[:], db.FeeCommit, revert))
+			// a mark left behind is dropped when its reveal would revert.
+			writeFailed("drop unrevealed mark", seedHash[:], db.DelUnRevealSeed(s.ldb, seedHash[:]))
+		}
+	})
+	return err
 }
 
+// DoReveal queues a reveal of commit, a commit already queued is not
+// queued twice.
 func (s *MonitorService) DoReveal(commit []byte) {
-	s.revealTask <- commit
+	s.queue.push(commit, s.deadline(commit))
 }
 
 func (s *MonitorService) MergeRecord(waittoreveal [][]byte) [][]byte {
@@ -252,97 +506,191 @@ func (s *MonitorService) MergeRecord(waittoreveal [][]byte) [][]byte {
 
 	var uncommitmap = make(map[common.Hash]contracts.Commit)
 	curblock,_ := s.client.BlockNumber(s.ctx)
-	logs.Info("goto merge record", "wait to reveal length", len(waittoreveal))
+	log.Info("goto merge record", "waitToReveal", len(waittoreveal))
 	for i:=0; i < len(waittoreveal); i++ {
-		logs.Info("goto merge record", "waittoreveal ", waittoreveal[i])
+		log.Debug("goto merge record", log.FieldCommit, common.BytesToHash(waittoreveal[i]))
 	}
 
 	// load unrevealed commit list from contract.
 	uncommited, err := s.oracleContract.GetUserUnverifiedList(s.callopt, s.user)
 	if err != nil {
-		logs.Error("can't get user unverified list", "err", err)
+		log.Error("can't get user unverified list", "err", err)
 	}
-	logs.Info("got uncommited", "length is", len(uncommited))
+	log.Info("got uncommited", "count", len(uncommited))
 	for _, cml := range uncommited {
 		h := common.Hash{}
 		h.SetBytes(cml.Commit[:])
 		uncommitmap[h] = cml
-		//logs.Info("there are commit unverified", "hash", h)
+		//log.Info("there are commit unverified", log.FieldCommit, h)
 	}
 
 	for _, seedhash := range waittoreveal {
 		h := common.Hash{}
 		h.SetBytes(seedhash[:])
-		logs.Info("check commit to reveal", "hash", h)
+		log.Debug("check commit to reveal", log.FieldCommit, h)
 		if _,exist := needtorevealmap[h]; exist {
 			continue
 		}
 
 		if info,exist := uncommitmap[h]; exist {
 			if (info.Block.Int64() + MAX_UNVERIFY_BLOCK) <= int64(curblock) {
-				logs.Info("check commit to reveal", "hash", h, "timeout", true)
+				log.Info("check commit to reveal", log.FieldCommit, h, "timeout", true)
 				// timeout
+				s.expired(h.Bytes(), info.Block.Uint64()+MAX_UNVERIFY_BLOCK)
 			} else {
 				needtorevealmap[h] = true
 				needtoreveal = append(needtoreveal, h.Bytes())
-				logs.Info("check commit to reveal", "hash", h, "addtoreveal", true)
+				s.queue.push(h.Bytes(), info.Block.Uint64()+MAX_UNVERIFY_BLOCK)
+				log.Info("check commit to reveal", log.FieldCommit, h, "addToReveal", true)
 			}
 		} else {
 			// wait commit can find in contract.
-			logs.Info("check commit to reveal", "hash", h, "not found in contract", true)
+			log.Info("check commit to reveal", log.FieldCommit, h, "notFoundInContract", true)
 		}
 	}
-	logs.Info("merged commit need to reveal", "length", len(needtoreveal))
+	log.Info("merged commit need to reveal", "count", len(needtoreveal))
 	return needtoreveal
 }
 
-func (s *MonitorService) Run() {
-	needreveal := s.MergeRecord(db.GetAllUnReveald(s.ldb))
-	for _, r := range needreveal {
-		s.doReveal(r, false)
+// expired gives up the reveal of a commit that passed its deadline.
+func (s *MonitorService) expired(commit []byte, deadline uint64) {
+	h := common.BytesToHash(commit)
+	alert.Fire(alert.KindCommitExpire, alert.LevelWarn, h.Hex(), "commit %s expired at block %d before reveal",
+		h.Hex(), deadline)
+	writeFailed("save commit expiry", commit, db.SetLifeExpired(s.ldb, commit, deadline))
+	s.queue.done(commit)
+}
+
+// writeFailed logs err of a store write about commit that runs after the
+// chain already moved on, so there is nothing to return it to.
+func writeFailed(what string, commit []byte, err error) {
+	if err != nil {
+		log.Error(what+" failed", log.FieldCommit, common.BytesToHash(commit), "err", err)
 	}
+}
 
-	committicker := time.NewTicker(time.Second * 15)
+// revealLoop sends the reveals of all due jobs without waiting for their
+// receipts, a job stays running until its receipt callback finishes it, so
+// there is never more than one reveal of a commit in flight.
+func (s *MonitorService) revealLoop() {
+	ticker := time.NewTicker(time.Second * 5)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.queue.wake:
+		}
+		if !s.canReveal() {
+			continue
+		}
+		jobs := s.queue.due(time.Now())
+		if len(jobs) == 0 {
+			continue
+		}
+		curblock, err := s.client.BlockNumber(s.ctx)
+		for i, job := range jobs {
+			if !s.canReveal() {
+				for _, rest := range jobs[i:] {
+					s.queue.release(rest.Commit)
+				}
+				break
+			}
+			if err == nil && job.Deadline != 0 && curblock >= job.Deadline {
+				s.expired(job.Commit, job.Deadline)
+				continue
+			}
+			done, err := s.sendReveal(job)
+			if done {
+				s.queue.done(job.Commit)
+			} else if err != nil {
+				alert.Fire(alert.KindRevealFailed, alert.LevelCritical, hex.EncodeToString(job.Commit),
+					"reveal of commit %s failed (%v), attempt %d, retry later", hex.EncodeToString(job.Commit), err, job.Attempts+1)
+				s.queue.retry(job, err.Error())
+			}
+		}
+	}
+}
+
+// mergeUnrevealed queues the stored commits waiting for reveal.
+func (s *MonitorService) mergeUnrevealed() {
+	list, err := db.GetAllUnReveald(s.ldb)
+	if err != nil {
+		log.Error("read unrevealed commits failed", "err", err)
+		return
+	}
+	s.MergeRecord(list)
+}
+
+// Run commits and reveals until stop is closed, it returns once every
+// loop it started is done.
+func (s *MonitorService) Run(stop <-chan struct{}) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer s.cancel()
+	loop := func(fn func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn()
+		}()
+	}
+	loop(func() { s.watcher.run(s.ctx) })
+	if s.canReveal() {
+		s.ensureApproved()
+		s.mergeUnrevealed()
+	}
+
+	changed := config.Changed()
+	runtime := config.Current()
+	commitInterval, revealInterval := runtime.CommitInterval, runtime.RevealInterval
+	committicker := time.NewTicker(commitInterval)
 	defer committicker.Stop()
 
-	revealticker := time.NewTicker(time.Second * 20)
+	revealticker := time.NewTicker(revealInterval)
 	defer revealticker.Stop()
 
-	go func() {
-		for {
-			select {
-			case commit,ok := <-s.revealTask:
-				if !ok {
-					return
-				}
-				succeed := s.doReveal(commit,false)
-				if succeed {
-					db.DelUnRevealSeed(s.ldb, commit)
-				} else {
-					s.AddToRevealAgain(commit)
-				}
-			}
-		}
-	}()
+	loop(s.revealLoop)
+	loop(s.reconcileLoop)
 
 	for {
 		select {
+		case <-stop:
+			return
+
+		case <-changed:
+			// a new interval starts counting now, not after the next tick
+			// of the old one.
+			changed = config.Changed()
+			runtime = config.Current()
+			if runtime.CommitInterval != commitInterval {
+				commitInterval = runtime.CommitInterval
+				committicker.Reset(commitInterval)
+			}
+			if runtime.RevealInterval != revealInterval {
+				revealInterval = runtime.RevealInterval
+				revealticker.Reset(revealInterval)
+			}
+
 		case <- committicker.C:
-			if len(s.revealTask) < 10 {
+			runtime = config.Current()
+			if !s.canCommit() {
+				continue
+			}
+			s.ensureApproved()
+			s.checkBalance()
+			if s.queue.len() < runtime.MaxRevealBacklog {
 				s.DoCommit()
 			}
 
 		case <- revealticker.C:
-			unrevealed := db.GetAllUnReveald(s.ldb)
-			s.waitmux.Lock()
-			unrevealed = append(unrevealed,s.waittoreveal...)
-			s.waittoreveal = make([][]byte,0)
-			s.waitmux.Unlock()
-			needreveal := s.MergeRecord(unrevealed)
-			for _, r := range needreveal {
-				s.DoReveal(r)
+			if !s.canReveal() {
+				continue
 			}
+			// queued commits are skipped by the queue, this only picks up
+			// commits whose events were missed.
+			s.mergeUnrevealed()
 		}
 	}
 }
-
@@ -0,0 +1,190 @@
+package monitor
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hpb-project/srng-robot/config"
+	"github.com/hpb-project/srng-robot/contracts"
+	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/log"
+	"github.com/hpb-project/srng-robot/services/pullevent"
+)
+
+// phantomGrace is how long after its commit tx was signed a commit the
+// oracle does not know yet is not taken for one that never landed. A
+// phantom that is mined after all gets its unrevealed mark back from the
+// CommitHash event.
+const phantomGrace = time.Minute * 10
+
+// Reconcile compares the local commits waiting for a reveal with the
+// commit lists of the oracle and fixes the drift: commits expired on chain
+// and commits revealed without the event being synced stop waiting, commits
+// that never landed are dropped. Runs that changed something are stored.
+func (s *MonitorService) Reconcile() (*db.ReconcileReport, error) {
+	s.reconcileMux.Lock()
+	defer s.reconcileMux.Unlock()
+
+	// local first, a commit added after it isn't checked. the txs before
+	// the oracle, a commit tx landing in between is then known.
+	local, err := db.GetAllUnReveald(s.ldb)
+	if err != nil {
+		return nil, err
+	}
+	sending, err := s.sendingCommits()
+	if err != nil {
+		return nil, err
+	}
+	head, err := s.client.BlockNumber(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	unverified, err := s.oracleContract.GetUserUnverifiedList(s.callopt, s.user)
+	if err != nil {
+		return nil, fmt.Errorf("get user unverified list: %v", err)
+	}
+	commits, err := s.oracleContract.GetUserCommitsList(s.callopt, s.user)
+	if err != nil {
+		return nil, fmt.Errorf("get user commits list: %v", err)
+	}
+	synced := uint64(0)
+	value, exist, err := s.ldb.Get([]byte(pullevent.LastSyncBlockKey))
+	if err != nil {
+		return nil, err
+	}
+	if exist {
+		synced = new(big.Int).SetBytes(value).Uint64()
+	}
+	waiting := make(map[common.Hash]contracts.Commit)
+	for _, c := range unverified {
+		waiting[c.Commit] = c
+	}
+	onChain := make(map[common.Hash]contracts.Commit)
+	for _, c := range commits {
+		onChain[c.Commit] = c
+	}
+
+	report := db.ReconcileReport{Time: time.Now().Unix(), Block: head, Local: len(local), Unverified: len(unverified),
+		Changes: make([]db.DriftChange, 0)}
+	fixed := make([][]byte, 0)
+	err = s.ldb.Update(func(b db.Batch) error {
+		for _, commit := range local {
+			h := common.BytesToHash(commit)
+			change := db.DriftChange{Commit: h.Hex()}
+			if c, exist := waiting[h]; exist {
+				deadline := c.Block.Uint64() + MAX_UNVERIFY_BLOCK
+				if deadline > head {
+					continue
+				}
+				change.Kind, change.Detail = db.DriftExpired, fmt.Sprintf("not revealed before block %d", deadline)
+				if err := db.SetLifeExpired(b, commit, deadline); err != nil {
+					return err
+				}
+			} else if c, exist := onChain[h]; exist && c.Revealed {
+				if c.VerifiedBlock.Uint64() >= synced {
+					// the sync gets to the reveal event soon.
+					continue
+				}
+				change.Kind, change.Detail = db.DriftRevealed, fmt.Sprintf("revealed in block %d", c.VerifiedBlock)
+				if err := db.SetSeedHashAndSeed(b, commit, c.Seed[:]); err != nil {
+					return err
+				}
+				if err := db.SetRevealedSeed(b, commit); err != nil {
+					return err
+				}
+			} else if exist {
+				deadline := c.Block.Uint64() + MAX_UNVERIFY_BLOCK
+				change.Kind, change.Detail = db.DriftExpired, fmt.Sprintf("left the unverified list, deadline block %d", deadline)
+				if err := db.SetLifeExpired(b, commit, deadline); err != nil {
+					return err
+				}
+			} else if sending[h] {
+				continue
+			} else {
+				change.Kind, change.Detail = db.DriftPhantom, "not on chain and no recent commit tx"
+				if err := db.SetLifeError(b, commit, db.FeeCommit, "commit never landed"); err != nil {
+					return err
+				}
+			}
+			if err := db.DelUnRevealSeed(b, commit); err != nil {
+				return err
+			}
+			report.Changes = append(report.Changes, change)
+			fixed = append(fixed, commit)
+		}
+		if len(report.Changes) == 0 {
+			return nil
+		}
+		return db.AppendReconcileReport(b, report)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, commit := range fixed {
+		s.queue.done(commit)
+	}
+	for _, c := range report.Changes {
+		log.Warn("reconciled commit", log.FieldCommit, c.Commit, "drift", c.Kind, "detail", c.Detail)
+	}
+	log.Info("reconciled commits", log.FieldBlock, head, "local", report.Local, "unverified", report.Unverified,
+		"changes", len(report.Changes))
+	s.lastReconcile = &report
+	return &report, nil
+}
+
+// sendingCommits returns the commits of the commit txs signed within
+// phantomGrace that did not fail, the oracle may not list them yet.
+func (s *MonitorService) sendingCommits() (map[common.Hash]bool, error) {
+	since := time.Now().Add(-phantomGrace).Unix()
+	records, err := db.GetTxRecordsSince(s.ldb, since)
+	if err != nil {
+		return nil, err
+	}
+	sending := make(map[common.Hash]bool)
+	for _, r := range db.FilterTxRecords(records, db.TxFilter{Purpose: TxCommit, Since: since}) {
+		if r.Status != db.TxFailed && r.Status != db.TxNotSent {
+			sending[common.HexToHash(r.Commit)] = true
+		}
+	}
+	return sending, nil
+}
+
+// LastReconcile returns the report of the last reconcile run, nil before
+// the first one.
+func (s *MonitorService) LastReconcile() *db.ReconcileReport {
+	s.reconcileMux.Lock()
+	defer s.reconcileMux.Unlock()
+	return s.lastReconcile
+}
+
+func (s *MonitorService) reconcileLoop() {
+	changed := config.Changed()
+	interval := config.Current().ReconcileInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-changed:
+			changed = config.Changed()
+			if next := config.Current().ReconcileInterval; next != interval {
+				interval = next
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(interval)
+			}
+		case <-timer.C:
+			if s.canReveal() {
+				if _, err := s.Reconcile(); err != nil {
+					log.Error("reconcile commits failed", "err", err)
+				}
+			}
+			interval = config.Current().ReconcileInterval
+			timer.Reset(interval)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package monitor
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/log"
+)
+
+const (
+	revealRetryMin = time.Second * 10
+	revealRetryMax = time.Minute * 5
+)
+
+// revealQueue is the durable queue of reveals, one job per commit. A job
+// handed out by due is not handed out again until it is done or retried.
+type revealQueue struct {
+	mu      sync.Mutex
+	ldb     db.Store
+	running map[common.Hash]bool
+	wake    chan struct{}
+}
+
+func newRevealQueue(ldb db.Store) *revealQueue {
+	return &revealQueue{ldb: ldb, running: make(map[common.Hash]bool), wake: make(chan struct{}, 1)}
+}
+
+// push adds a job for commit unless there is one already, a known deadline
+// fills in the one of an existing job.
+func (q *revealQueue) push(commit []byte, deadline uint64) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, exist := db.GetRevealJob(q.ldb, commit)
+	if exist {
+		if job.Deadline == 0 && deadline != 0 {
+			job.Deadline = deadline
+			db.SetRevealJob(q.ldb, job)
+		}
+		return false
+	}
+	now := time.Now().Unix()
+	job = db.RevealJob{Commit: common.CopyBytes(commit), NextAttempt: now, Deadline: deadline, Created: now}
+	if err := db.SetRevealJob(q.ldb, job); err != nil {
+		log.Error("queue reveal failed", log.FieldCommit, common.BytesToHash(commit), "err", err)
+		return false
+	}
+	log.Info("queue reveal", log.FieldCommit, common.BytesToHash(commit), "deadline", deadline)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// due returns the jobs to attempt now, the most urgent first, and marks
+// them running.
+func (q *revealQueue) due(now time.Time) []db.RevealJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]db.RevealJob, 0)
+	for _, job := range db.GetAllRevealJobs(q.ldb) {
+		if q.running[common.BytesToHash(job.Commit)] || job.NextAttempt > now.Unix() {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Deadline == 0 || jobs[j].Deadline == 0 {
+			return jobs[i].Deadline != 0
+		}
+		return jobs[i].Deadline < jobs[j].Deadline
+	})
+	for _, job := range jobs {
+		q.running[common.BytesToHash(job.Commit)] = true
+	}
+	return jobs
+}
+
+// done removes the job of commit, it was revealed or can't be anymore.
+func (q *revealQueue) done(commit []byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.running, common.BytesToHash(commit))
+	db.DelRevealJob(q.ldb, commit)
+}
+
+// retry schedules the next attempt of a failed job with a growing delay.
+func (q *revealQueue) retry(job db.RevealJob, reason string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.running, common.BytesToHash(job.Commit))
+	job.Attempts++
+	job.LastError = reason
+	delay := revealRetryMin << uint(job.Attempts-1)
+	if delay > revealRetryMax || delay <= 0 {
+		delay = revealRetryMax
+	}
+	job.NextAttempt = time.Now().Add(delay).Unix()
+	db.SetRevealJob(q.ldb, job)
+}
+
+func (q *revealQueue) len() int {
+	return len(db.GetAllRevealJobs(q.ldb))
+}
+
+// release hands a job back without counting an attempt.
+func (q *revealQueue) release(commit []byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.running, common.BytesToHash(commit))
+}
@@ -0,0 +1,140 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/hpb-project/srng-robot/contracts"
+)
+
+var panicSelector = crypto.Keccak256([]byte("Panic(uint256)"))[:4]
+
+// RevertError is a call that the evm reverted, Reason is decoded from the
+// revert data when possible.
+type RevertError struct {
+	Reason string
+}
+
+func (e *RevertError) Error() string {
+	if e.Reason == "" {
+		return "execution reverted"
+	}
+	return "execution reverted: " + e.Reason
+}
+
+// errorAbis are searched for custom errors, the oracle declares none today
+// but a redeployed one may.
+var errorAbis = func() []*abi.ABI {
+	list := make([]*abi.ABI, 0)
+	for _, meta := range []*bind.MetaData{contracts.OracleMetaData, contracts.TokenMetaData} {
+		if parsed, err := meta.GetAbi(); err == nil {
+			list = append(list, parsed)
+		}
+	}
+	return list
+}()
+
+// decodeRevert turns revert data into a readable reason.
+func decodeRevert(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	if reason, err := abi.UnpackRevert(data); err == nil {
+		return reason
+	}
+	if len(data) == 36 && bytes.Equal(data[:4], panicSelector) {
+		return fmt.Sprintf("panic(0x%x)", new(big.Int).SetBytes(data[4:]))
+	}
+	for _, parsed := range errorAbis {
+		for _, e := range parsed.Errors {
+			e := e
+			if len(data) < 4 || !bytes.Equal(data[:4], e.ID[:4]) {
+				continue
+			}
+			values, err := e.Unpack(data)
+			if err != nil {
+				continue
+			}
+			args := make([]string, 0)
+			if list, ok := values.([]interface{}); ok {
+				for _, v := range list {
+					args = append(args, fmt.Sprint(v))
+				}
+			}
+			return fmt.Sprintf("%s(%s)", e.Name, strings.Join(args, ", "))
+		}
+	}
+	return "0x" + hex.EncodeToString(data)
+}
+
+// callError converts the error of an eth_call into a RevertError when the
+// node reports a revert, other errors are returned as they are.
+func callError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		if s, ok := dataErr.ErrorData().(string); ok {
+			if data, derr := hexutil.Decode(s); derr == nil {
+				return &RevertError{Reason: decodeRevert(data)}
+			}
+		}
+	}
+	if msg := err.Error(); strings.HasPrefix(msg, "execution reverted") {
+		return &RevertError{Reason: strings.TrimPrefix(strings.TrimPrefix(msg, "execution reverted"), ": ")}
+	}
+	return err
+}
+
+func callMsg(tx *types.Transaction) (ethereum.CallMsg, error) {
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return ethereum.CallMsg{}, err
+	}
+	return ethereum.CallMsg{From: from, To: tx.To(), Gas: tx.Gas(), GasPrice: tx.GasPrice(),
+		Value: tx.Value(), Data: tx.Data()}, nil
+}
+
+// simulate runs tx with eth_call against the pending state, a tx that
+// would revert returns a RevertError.
+func simulate(ctx context.Context, client *ethclient.Client, tx *types.Transaction) error {
+	msg, err := callMsg(tx)
+	if err != nil {
+		return err
+	}
+	_, err = client.PendingCallContract(ctx, msg)
+	return callError(err)
+}
+
+// revertReason replays a failed tx on the state before its block to find
+// out why it reverted, empty when the replay doesn't revert.
+func revertReason(ctx context.Context, client *ethclient.Client, tx *types.Transaction, receipt *types.Receipt) string {
+	msg, err := callMsg(tx)
+	if err != nil {
+		return ""
+	}
+	parent := new(big.Int).Sub(receipt.BlockNumber, big.NewInt(1))
+	_, err = client.CallContract(ctx, msg, parent)
+	var revert *RevertError
+	if errors.As(callError(err), &revert) {
+		return revert.Reason
+	}
+	if receipt.GasUsed == tx.Gas() {
+		return "out of gas"
+	}
+	return ""
+}
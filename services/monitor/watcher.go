@@ -0,0 +1,205 @@
+package monitor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/hpb-project/srng-robot/config"
+	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/log"
+)
+
+const (
+	// watchInterval is how often the head is polled when the node can't
+	// push new heads, and how often timeouts are checked.
+	watchInterval = time.Second * 2
+	// txTimeout is how long a sent tx may stay unmined before it is given
+	// up, its owner decides whether to send it again.
+	txTimeout = time.Minute * 2
+	// receiptBatch is the most receipts asked for in one rpc batch.
+	receiptBatch = 100
+)
+
+// receiptFunc is called once with the receipt of a watched tx, or with nil
+// when it timed out. revert is the reason a failed tx reverted with.
+type receiptFunc func(receipt *types.Receipt, revert string)
+
+type watchedTx struct {
+	tx    *types.Transaction
+	sent  time.Time
+	done  receiptFunc
+	mined bool // seen in a block, waiting for confirmations, until a reorg drops it
+}
+
+// txWatcher follows all sent txs of the robot. On every new head it asks
+// for the receipts of all pending txs in one batch and hands those with
+// enough confirmations to the callbacks they were registered with.
+type txWatcher struct {
+	mu      sync.Mutex
+	rpc     *rpc.Client
+	client  *ethclient.Client
+	ldb     db.Store
+	pending map[common.Hash]*watchedTx
+}
+
+func newTxWatcher(rpcClient *rpc.Client, ldb db.Store) *txWatcher {
+	return &txWatcher{rpc: rpcClient, client: ethclient.NewClient(rpcClient), ldb: ldb,
+		pending: make(map[common.Hash]*watchedTx)}
+}
+
+// watch registers tx, done runs on the watcher goroutine and must not block.
+func (w *txWatcher) watch(tx *types.Transaction, done receiptFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	log.Debug("watch tx", log.FieldTx, tx.Hash(), log.FieldNonce, tx.Nonce())
+	w.pending[tx.Hash()] = &watchedTx{tx: tx, sent: time.Now(), done: done}
+}
+
+// wait blocks until the receipt of tx arrives or it times out.
+func (w *txWatcher) wait(tx *types.Transaction) *types.Receipt {
+	result := make(chan *types.Receipt, 1)
+	w.watch(tx, func(receipt *types.Receipt, revert string) { result <- receipt })
+	return <-result
+}
+
+func (w *txWatcher) len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pending)
+}
+
+// run follows new heads by subscription, or by polling when the node
+// doesn't support it, until ctx is done.
+func (w *txWatcher) run(ctx context.Context) {
+	heads := make(chan *types.Header, 16)
+	var subErr <-chan error
+	sub, err := w.client.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		log.Info("new head subscription unavailable, poll for blocks", "err", err)
+		heads = nil
+	} else {
+		defer sub.Unsubscribe()
+		subErr = sub.Err()
+	}
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	var head uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case h := <-heads:
+			head = h.Number.Uint64()
+			w.check(ctx, head, true)
+
+		case err := <-subErr:
+			log.Warn("new head subscription dropped, poll for blocks", "err", err)
+			subErr, heads = nil, nil
+
+		case <-ticker.C:
+			if heads != nil {
+				w.check(ctx, head, false)
+				continue
+			}
+			number, err := w.client.BlockNumber(ctx)
+			if err != nil {
+				log.Error("get block number failed", "err", err)
+				w.check(ctx, head, false)
+				continue
+			}
+			changed := number != head
+			head = number
+			w.check(ctx, head, changed)
+		}
+	}
+}
+
+// check resolves the pending txs that are confirmed at head, fetch is false
+// when head didn't move and only timeouts need a look.
+func (w *txWatcher) check(ctx context.Context, head uint64, fetch bool) {
+	w.mu.Lock()
+	list := make([]*watchedTx, 0, len(w.pending))
+	for _, p := range w.pending {
+		list = append(list, p)
+	}
+	w.mu.Unlock()
+	if len(list) == 0 {
+		return
+	}
+
+	receipts := make([]*types.Receipt, len(list))
+	if fetch {
+		depth := config.Current().Confirmations
+		for start := 0; start < len(list); start += receiptBatch {
+			end := start + receiptBatch
+			if end > len(list) {
+				end = len(list)
+			}
+			batch := make([]rpc.BatchElem, 0, end-start)
+			for i := start; i < end; i++ {
+				batch = append(batch, rpc.BatchElem{Method: "eth_getTransactionReceipt",
+					Args: []interface{}{list[i].tx.Hash()}, Result: &receipts[i]})
+			}
+			if err := w.rpc.BatchCallContext(ctx, batch); err != nil {
+				log.Error("get receipts failed", log.FieldBlock, head, "err", err)
+				break
+			}
+			for i, elem := range batch {
+				r := receipts[start+i]
+				if elem.Error != nil || r == nil || r.BlockNumber == nil {
+					receipts[start+i] = nil
+					if p := list[start+i]; elem.Error == nil && p.mined {
+						// the block was reorged away, wait for the tx to be
+						// mined again or time out from now.
+						log.Warn("mined tx lost its receipt", log.FieldTx, p.tx.Hash(), log.FieldNonce, p.tx.Nonce())
+						p.mined, p.sent = false, time.Now()
+					}
+					continue
+				}
+				if head+1 < r.BlockNumber.Uint64()+depth {
+					// mined but not deep enough yet.
+					list[start+i].mined = true
+					receipts[start+i] = nil
+				}
+			}
+		}
+	}
+
+	for i, p := range list {
+		if receipts[i] != nil {
+			w.resolve(ctx, p, receipts[i])
+		} else if !p.mined && time.Since(p.sent) > txTimeout {
+			w.resolve(ctx, p, nil)
+		}
+	}
+}
+
+// resolve writes the outcome of p to the audit log and runs its callback.
+func (w *txWatcher) resolve(ctx context.Context, p *watchedTx, receipt *types.Receipt) {
+	w.mu.Lock()
+	delete(w.pending, p.tx.Hash())
+	w.mu.Unlock()
+
+	entry := db.AuditEntry{Event: db.AuditReceipt, TxHash: p.tx.Hash().Hex(), Status: db.TxTimeout}
+	if receipt != nil {
+		entry.Status = db.TxSuccess
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			entry.Status = db.TxFailed
+			entry.Error = revertReason(ctx, w.client, p.tx, receipt)
+		}
+		entry.Block, entry.GasUsed = receipt.BlockNumber.Uint64(), receipt.GasUsed
+	}
+	db.AppendTxAudit(w.ldb, entry)
+	log.Info("tx resolved", log.FieldTx, p.tx.Hash(), log.FieldNonce, p.tx.Nonce(), log.FieldBlock, entry.Block,
+		"status", entry.Status, "reason", entry.Error)
+	if p.done != nil {
+		p.done(receipt, entry.Error)
+	}
+}
@@ -0,0 +1,202 @@
+package pullevent
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/log"
+)
+
+const (
+	// catchUpLag is how far behind the head the sync switches to catch up.
+	catchUpLag = 100
+
+	// queryTimeout bounds one log query, a node that can't answer in time
+	// gets a smaller range.
+	queryTimeout = time.Second * 30
+
+	// growAfter is how many full range queries in a row have to succeed
+	// before the range grows again.
+	growAfter = 16
+)
+
+// chunk is a block range fetched by one catch up worker.
+type chunk struct {
+	from, to uint64
+	logs     []types.Log
+	err      error
+	done     chan struct{}
+}
+
+// catchUp syncs the blocks up to head. Chunks of the range are fetched by
+// up to SyncWorkers queries at once and applied in block order, the sync
+// cursor moves with every applied chunk.
+func (p *PullEvent) catchUp(head uint64) error {
+	ctx, cancel := context.WithCancel(p.ctx)
+	defer cancel()
+
+	from := p.lastBlock.Uint64()
+	log.Info("catch up sync", "from", from, "to", head, "workers", p.workers, "range", atomic.LoadUint64(&p.span))
+	ordered := make(chan *chunk, p.workers)
+	sem := make(chan struct{}, p.workers)
+	go func() {
+		defer close(ordered)
+		for start := from; start <= head; {
+			end := start + p.maxSpan - 1
+			if end > head {
+				end = head
+			}
+			c := &chunk{from: start, to: end, done: make(chan struct{})}
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func() {
+				c.logs, c.err = p.fetch(ctx, c.from, c.to)
+				<-sem
+				close(c.done)
+			}()
+			select {
+			case ordered <- c:
+			case <-ctx.Done():
+				return
+			}
+			start = end + 1
+		}
+	}()
+
+	started := time.Now()
+	for c := range ordered {
+		<-c.done
+		if c.err != nil {
+			return c.err
+		}
+		if err := p.apply(c.logs, c.to, true); err != nil {
+			return err
+		}
+		log.Info("catch up synced", "from", c.from, "to", c.to, "logs", len(c.logs),
+			"left", head-c.to, "elapsed", time.Since(started).Round(time.Second))
+	}
+	return nil
+}
+
+// fetch gets the logs of [from, to]. A query the node rejects as too large or
+// doesn't answer in time is split, the span of later queries shrinks with it
+// and grows back after successful queries.
+func (p *PullEvent) fetch(ctx context.Context, from uint64, to uint64) ([]types.Log, error) {
+	var logs []types.Log
+	for start := from; start <= to; {
+		span := atomic.LoadUint64(&p.span)
+		end := start + span - 1
+		if end > to {
+			end = to
+		}
+		qctx, cancel := context.WithTimeout(ctx, queryTimeout)
+		list, err := p.filterLogs(qctx, start, end)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if !rangeTooLarge(err) || end == start {
+				return nil, err
+			}
+			shrink := (end - start + 1) / 2
+			atomic.StoreUint64(&p.span, shrink)
+			atomic.StoreUint64(&p.spanOK, 0)
+			log.Warn("log query too large, shrink range", "from", start, "to", end, "range", shrink, "err", err)
+			continue
+		}
+		logs = append(logs, list...)
+		if span < p.maxSpan && end-start+1 == span && atomic.AddUint64(&p.spanOK, 1) >= growAfter {
+			grow := span * 2
+			if grow > p.maxSpan {
+				grow = p.maxSpan
+			}
+			if atomic.CompareAndSwapUint64(&p.span, span, grow) {
+				atomic.StoreUint64(&p.spanOK, 0)
+			}
+		}
+		start = end + 1
+	}
+	return logs, nil
+}
+
+// filterLogs runs the queries of the registry for [from, to] and returns
+// their logs in chain order, a log matched by several queries only once.
+func (p *PullEvent) filterLogs(ctx context.Context, from uint64, to uint64) ([]types.Log, error) {
+	queries := p.registry.Queries(new(big.Int).SetUint64(from), new(big.Int).SetUint64(to))
+	if len(queries) == 1 {
+		return p.filterer.FilterLogs(ctx, queries[0])
+	}
+	type logID struct {
+		block common.Hash
+		index uint
+	}
+	seen := make(map[logID]bool)
+	var logs []types.Log
+	for _, q := range queries {
+		list, err := p.filterer.FilterLogs(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range list {
+			id := logID{l.BlockHash, l.Index}
+			if !seen[id] {
+				seen[id] = true
+				logs = append(logs, l)
+			}
+		}
+	}
+	sort.SliceStable(logs, func(i, j int) bool {
+		if logs[i].BlockNumber != logs[j].BlockNumber {
+			return logs[i].BlockNumber < logs[j].BlockNumber
+		}
+		return logs[i].Index < logs[j].Index
+	})
+	return logs, nil
+}
+
+// rangeTooLarge reports whether err means the node gave up on the size of a
+// log query rather than failed.
+func rangeTooLarge(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"too many", "limit exceeded", "more than", "range too large", "too large",
+		"response size", "timeout", "timed out"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply runs logs through the handlers and moves the sync cursor past to
+// in one write.
+func (p *PullEvent) apply(logs []types.Log, to uint64, history bool) error {
+	next := new(big.Int).SetUint64(to + 1)
+	err := p.ldb.Update(func(b db.Batch) error {
+		for _, vlog := range logs {
+			if err := p.registry.Dispatch(vlog, p, b, history); err != nil {
+				return err
+			}
+		}
+		return b.Set([]byte(LastSyncBlockKey), next.Bytes())
+	})
+	if err != nil {
+		return err
+	}
+	p.lastBlock = next
+	return nil
+}
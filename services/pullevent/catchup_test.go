@@ -0,0 +1,198 @@
+package pullevent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestRangeTooLarge(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{context.DeadlineExceeded, true},
+		{fmt.Errorf("filter logs: %w", context.DeadlineExceeded), true},
+		{errors.New("query returned more than 10000 results"), true},
+		{errors.New("Log response size exceeded. You can make eth_getLogs requests with up to a 2K block range"), true},
+		{errors.New("query limit exceeded"), true},
+		{errors.New("block range too large"), true},
+		{errors.New("request timed out"), true},
+		{errors.New("read tcp: i/o timeout"), true},
+		{errors.New("dial tcp 127.0.0.1:8545: connect: connection refused"), false},
+		{errors.New("execution reverted"), false},
+		{context.Canceled, false},
+	}
+	for _, tt := range tests {
+		if got := rangeTooLarge(tt.err); got != tt.want {
+			t.Errorf("rangeTooLarge(%q) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// fakeNode answers log queries with one log per block and rejects queries
+// of more than limit blocks, or any query with err.
+type fakeNode struct {
+	limit   uint64
+	err     error
+	queries [][2]uint64
+}
+
+func (f *fakeNode) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	from, to := q.FromBlock.Uint64(), q.ToBlock.Uint64()
+	f.queries = append(f.queries, [2]uint64{from, to})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.limit > 0 && to-from+1 > f.limit {
+		return nil, fmt.Errorf("query returned more than %d results", f.limit)
+	}
+	logs := make([]types.Log, 0, to-from+1)
+	for b := from; b <= to; b++ {
+		logs = append(logs, types.Log{Address: testContract, BlockNumber: b,
+			BlockHash: common.BigToHash(new(big.Int).SetUint64(b))})
+	}
+	return logs, nil
+}
+
+func (f *fakeNode) SubscribeFilterLogs(context.Context, ethereum.FilterQuery, chan<- types.Log) (ethereum.Subscription, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestFetch(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     fakeNode
+		span     uint64
+		maxSpan  uint64
+		from, to uint64
+		wantErr  bool
+		queries  [][2]uint64
+		wantSpan uint64
+	}{
+		{
+			name: "range fits",
+			span: 50, maxSpan: 50, from: 0, to: 99,
+			queries:  [][2]uint64{{0, 49}, {50, 99}},
+			wantSpan: 50,
+		},
+		{
+			name: "last query is cut at to",
+			span: 40, maxSpan: 40, from: 10, to: 59,
+			queries:  [][2]uint64{{10, 49}, {50, 59}},
+			wantSpan: 40,
+		},
+		{
+			name: "too large shrinks",
+			node: fakeNode{limit: 30},
+			span: 100, maxSpan: 100, from: 0, to: 99,
+			queries:  [][2]uint64{{0, 99}, {0, 49}, {0, 24}, {25, 49}, {50, 74}, {75, 99}},
+			wantSpan: 25,
+		},
+		{
+			name: "single block too large fails",
+			node: fakeNode{err: errors.New("query returned more than 10000 results")},
+			span: 2, maxSpan: 2, from: 5, to: 6,
+			wantErr:  true,
+			queries:  [][2]uint64{{5, 6}, {5, 5}},
+			wantSpan: 1,
+		},
+		{
+			name: "other errors are not retried",
+			node: fakeNode{err: errors.New("connection refused")},
+			span: 10, maxSpan: 10, from: 0, to: 99,
+			wantErr:  true,
+			queries:  [][2]uint64{{0, 9}},
+			wantSpan: 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testPullEvent(t, &tt.node, tt.span, tt.maxSpan)
+			logs, err := p.fetch(context.Background(), tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetch error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(tt.node.queries, tt.queries) {
+				t.Fatalf("queries %v, want %v", tt.node.queries, tt.queries)
+			}
+			if p.span != tt.wantSpan {
+				t.Fatalf("span %d, want %d", p.span, tt.wantSpan)
+			}
+			if err == nil {
+				checkLogs(t, logs, tt.from, tt.to)
+			}
+		})
+	}
+}
+
+func TestFetchGrows(t *testing.T) {
+	tests := []struct {
+		name     string
+		span     uint64
+		maxSpan  uint64
+		to       uint64
+		queries  int
+		wantSpan uint64
+	}{
+		// growAfter full queries of 10 blocks, then two of 20.
+		{name: "doubles", span: 10, maxSpan: 40, to: growAfter*10 + 39, queries: growAfter + 2, wantSpan: 20},
+		{name: "capped at max", span: 30, maxSpan: 40, to: growAfter*30 + 39, queries: growAfter + 1, wantSpan: 40},
+		{name: "not before growAfter", span: 10, maxSpan: 40, to: (growAfter-1)*10 - 1, queries: growAfter - 1, wantSpan: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &fakeNode{}
+			p := testPullEvent(t, node, tt.span, tt.maxSpan)
+			logs, err := p.fetch(context.Background(), 0, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(node.queries) != tt.queries {
+				t.Fatalf("%d queries, want %d: %v", len(node.queries), tt.queries, node.queries)
+			}
+			if p.span != tt.wantSpan {
+				t.Fatalf("span %d, want %d", p.span, tt.wantSpan)
+			}
+			checkLogs(t, logs, 0, tt.to)
+		})
+	}
+}
+
+func TestFetchCancelled(t *testing.T) {
+	p := testPullEvent(t, &fakeNode{}, 10, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.fetch(ctx, 0, 99); !errors.Is(err, context.Canceled) {
+		t.Fatalf("fetch error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func testPullEvent(t *testing.T, node ethereum.LogFilterer, span uint64, maxSpan uint64) *PullEvent {
+	t.Helper()
+	r, _ := testRegistry(t)
+	return &PullEvent{ctx: context.Background(), filterer: node, registry: r, workers: 1, span: span, maxSpan: maxSpan}
+}
+
+// checkLogs fails unless logs holds the one log of every block in [from, to].
+func checkLogs(t *testing.T, logs []types.Log, from uint64, to uint64) {
+	t.Helper()
+	if uint64(len(logs)) != to-from+1 {
+		t.Fatalf("%d logs, want %d", len(logs), to-from+1)
+	}
+	for i, l := range logs {
+		if l.BlockNumber != from+uint64(i) {
+			t.Fatalf("log %d is of block %d, want %d", i, l.BlockNumber, from+uint64(i))
+		}
+	}
+}
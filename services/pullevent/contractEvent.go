@@ -1,77 +1,162 @@
 package pullevent
 
 import (
-	"encoding/hex"
-	"github.com/astaxie/beego/logs"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/hpb-project/srng-robot/contracts"
 	"github.com/hpb-project/srng-robot/db"
-	"strings"
+	"github.com/hpb-project/srng-robot/log"
 )
 
-func OracleContractHandler(vLog types.Log, pe *PullEvent, addr common.Address, history bool) error {
-	logs.Info("handler oracle contract logs")
-	filter, err := contracts.NewOracleFilterer(addr, pe.client)
+// oracleHandlers keeps the local state of our commits in line with the
+// oracle events.
+type oracleHandlers struct {
+	filter *contracts.OracleFilterer
+}
+
+// RegisterOracleHandlers adds the oracle at addr to r with the handlers the
+// robot itself needs.
+func RegisterOracleHandlers(r *Registry, addr common.Address, backend bind.ContractFilterer) error {
+	parsed, err := contracts.OracleMetaData.GetAbi()
+	if err != nil {
+		return err
+	}
+	filter, err := contracts.NewOracleFilterer(addr, backend)
 	if err != nil {
-		logs.Error("NewOracleFilter failed", "err", err)
 		return err
 	}
-	{
-		method := vLog.Topics[0]
-		switch strings.ToLower(method.String()) {
-		case EventSubscribe:
-			sub, err := filter.ParseSubscribe(vLog)
-			if err != nil {
-				logs.Error("parse subscribe event failed", "err", err)
-				return err
-			}
-			if sub.Commiter != pe.user {
-				return nil
-			}
-			// go to reveal.
-			logs.Info("got subscribe event","commithash", hex.EncodeToString(sub.Hash[:]), "consumer is", sub.Consumer)
-			if _, exist := db.GetSeedBySeedHash(pe.ldb, sub.Hash[:]); exist {
-				// check unreveal
-				if db.HasUnRevealSeed(pe.ldb, sub.Hash[:]) {
-					pe.work.Reveal(sub.Hash[:])
-				}
-			}
-			pe.work.Reveal(sub.Hash[:])
+	r.AddContract(addr, parsed)
+	h := &oracleHandlers{filter: filter}
+	for _, reg := range []struct {
+		event   string
+		policy  ErrorPolicy
+		handler EventHandler
+	}{
+		{"CommitHash", PolicyBlock, h.commitHash},
+		{"Subscribe", PolicyBlock, h.subscribe},
+		{"RevealSeed", PolicyBlock, h.revealSeed},
+		{"UnSubscribe", PolicySkip, h.unSubscribe},
+		{"RandomConsumed", PolicySkip, h.randomConsumed},
+	} {
+		if err := r.Register("oracle."+reg.event, addr, reg.event, reg.policy, reg.handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+func (h *oracleHandlers) subscribe(vLog types.Log, pe *PullEvent, b db.Batch, history bool) error {
+	sub, err := h.filter.ParseSubscribe(vLog)
+	if err != nil {
+		return err
+	}
+	if sub.Commiter != pe.user {
+		return nil
+	}
+	log.Info("got subscribe event", log.FieldCommit, common.Hash(sub.Hash), "consumer", sub.Consumer, log.FieldBlock, vLog.BlockNumber)
+	if err := db.SetTxCommit(b, vLog.TxHash.Bytes(), sub.Hash[:]); err != nil {
+		return err
+	}
+	if err := db.SetLifeSubscribe(b, sub.Hash[:], sub.Consumer.Hex(), vLog.BlockNumber, sub.Time.Uint64()); err != nil {
+		return err
+	}
+	// go to reveal, the queue keeps one job per commit. a late commit in
+	// the same block range has its mark only in b yet.
+	if db.HasUnRevealSeed(pe.ldb, sub.Hash[:]) || landedLate(pe.ldb, sub.Hash[:]) {
+		pe.reveal(sub.Hash[:], vLog.BlockNumber, history)
+	}
+	return nil
+}
 
-		case EventCommitHash:
-			commit, err := filter.ParseCommitHash(vLog)
-			if err != nil {
-				logs.Error("parse commit event failed", "err", err)
-				return err
-			}
-			if commit.Sender != pe.user {
-				return nil
-			}
-			logs.Info("got new commit event", "commit hash", hex.EncodeToString(commit.Hash[:]), "block", commit.Block)
-			// first check commit exist and unreveal.
+func (h *oracleHandlers) commitHash(vLog types.Log, pe *PullEvent, b db.Batch, history bool) error {
+	commit, err := h.filter.ParseCommitHash(vLog)
+	if err != nil {
+		return err
+	}
+	if commit.Sender != pe.user {
+		return nil
+	}
+	log.Info("got new commit event", log.FieldCommit, common.Hash(commit.Hash), log.FieldTx, vLog.TxHash, log.FieldBlock, vLog.BlockNumber)
+	if err := db.SetSeedHashAndCommit(b, commit.Hash[:], vLog.TxHash.Bytes()); err != nil {
+		return err
+	}
+	if err := db.SetTxCommit(b, vLog.TxHash.Bytes(), commit.Hash[:]); err != nil {
+		return err
+	}
+	// a commit past its reveal deadline, seen in a replay, stays dropped.
+	if vLog.BlockNumber+maxUnverifyBlock > pe.head && landedLate(pe.ldb, commit.Hash[:]) {
+		log.Warn("commit landed after it was dropped, wait for its reveal again", log.FieldCommit, common.Hash(commit.Hash),
+			log.FieldBlock, vLog.BlockNumber)
+		if err := db.SetUnRevealSeed(b, commit.Hash[:]); err != nil {
+			return err
+		}
+		if err := db.SetLifeError(b, commit.Hash[:], db.FeeCommit, ""); err != nil {
+			return err
+		}
+	}
+	return db.SetLifeCommit(b, commit.Hash[:], vLog.BlockNumber, commit.Time.Uint64(), vLog.TxHash.Bytes())
+}
 
-		case EventRevealSeed:
-			reveal, err := filter.ParseRevealSeed(vLog)
-			if err != nil {
-				logs.Error("parse reveal event failed", "err", err)
-				return err
-			}
-			if reveal.Commiter != pe.user {
-				return nil
-			}
-			logs.Info("got revealed event", "commit", hex.EncodeToString(reveal.Hash[:]))
-			// set commit reveal finished.
-			db.DelUnRevealSeed(pe.ldb, reveal.Hash[:])
-			db.SetSeedHashAndSeed(pe.ldb, reveal.Hash[:], reveal.Seed[:])
+// landedLate reports whether our commit of hash lost its unrevealed mark
+// before it was seen on chain, like one reconcile took for a phantom: the
+// seed is known, it was neither revealed nor expired.
+func landedLate(ldb db.Store, hash []byte) bool {
+	if _, exist := db.GetSeedBySeedHash(ldb, hash); !exist {
+		return false
+	}
+	if db.HasUnRevealSeed(ldb, hash) || db.HasRevealedSeed(ldb, hash) {
+		return false
+	}
+	l, exist := db.GetLifecycle(ldb, hash)
+	return !exist || l.ExpiredBlock == 0
+}
 
+func (h *oracleHandlers) revealSeed(vLog types.Log, pe *PullEvent, b db.Batch, history bool) error {
+	reveal, err := h.filter.ParseRevealSeed(vLog)
+	if err != nil {
+		return err
+	}
+	if reveal.Commiter != pe.user {
+		return nil
+	}
+	log.Info("got revealed event", log.FieldCommit, common.Hash(reveal.Hash), log.FieldTx, vLog.TxHash, log.FieldBlock, vLog.BlockNumber)
+	// set commit reveal finished.
+	if err := db.SetRevealed(b, reveal.Hash[:], reveal.Seed[:], vLog.TxHash.Bytes()); err != nil {
+		return err
+	}
+	if err := db.SetTxCommit(b, vLog.TxHash.Bytes(), reveal.Hash[:]); err != nil {
+		return err
+	}
+	return db.SetLifeReveal(b, reveal.Hash[:], vLog.BlockNumber, reveal.Time.Uint64(), vLog.TxHash.Bytes())
+}
 
-		case EventUnSubscribe, EventRandomConsumed:
-			// ignore event.
-		default:
-			// do nothing.
-		}
+func (h *oracleHandlers) unSubscribe(vLog types.Log, pe *PullEvent, b db.Batch, history bool) error {
+	unsub, err := h.filter.ParseUnSubscribe(vLog)
+	if err != nil {
+		return err
 	}
-	return nil
+	if unsub.Commiter != pe.user {
+		return nil
+	}
+	log.Info("got unsubscribe event", log.FieldCommit, common.Hash(unsub.Hash), "consumer", unsub.Consumer, log.FieldBlock, vLog.BlockNumber)
+	if err := db.SetTxCommit(b, vLog.TxHash.Bytes(), unsub.Hash[:]); err != nil {
+		return err
+	}
+	return db.SetLifeUnsubscribe(b, unsub.Hash[:], vLog.BlockNumber, unsub.Time.Uint64())
+}
+
+func (h *oracleHandlers) randomConsumed(vLog types.Log, pe *PullEvent, b db.Batch, history bool) error {
+	consumed, err := h.filter.ParseRandomConsumed(vLog)
+	if err != nil {
+		return err
+	}
+	if consumed.Commiter != pe.user {
+		return nil
+	}
+	log.Info("got random consumed event", log.FieldCommit, common.Hash(consumed.Hash), "consumer", consumed.Consumer, log.FieldBlock, vLog.BlockNumber)
+	if err := db.SetTxCommit(b, vLog.TxHash.Bytes(), consumed.Hash[:]); err != nil {
+		return err
+	}
+	return db.SetLifeConsumed(b, consumed.Hash[:], vLog.BlockNumber, consumed.Time.Uint64())
 }
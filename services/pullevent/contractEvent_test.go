@@ -0,0 +1,164 @@
+package pullevent
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hpb-project/srng-robot/contracts"
+	"github.com/hpb-project/srng-robot/db"
+)
+
+var (
+	testOracle   = common.HexToAddress("0x3000000000000000000000000000000000000003")
+	testUser     = common.HexToAddress("0x4000000000000000000000000000000000000004")
+	testConsumer = common.HexToAddress("0x5000000000000000000000000000000000000005")
+)
+
+// revealRecorder is a Worker that records the commits handed to Reveal.
+type revealRecorder struct {
+	reveals []common.Hash
+}
+
+func (w *revealRecorder) NewCommit() error { return nil }
+
+func (w *revealRecorder) Reveal(commit []byte) error {
+	w.reveals = append(w.reveals, common.BytesToHash(commit))
+	return nil
+}
+
+func oracleLog(t *testing.T, event string, block uint64, args ...interface{}) types.Log {
+	t.Helper()
+	parsed, err := contracts.OracleMetaData.GetAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := parsed.Events[event].Inputs.Pack(args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return types.Log{Address: testOracle, Topics: []common.Hash{parsed.Events[event].ID}, Data: data,
+		BlockNumber: block, TxHash: common.BigToHash(new(big.Int).SetUint64(block))}
+}
+
+func TestLateCommit(t *testing.T) {
+	hash := common.HexToHash("0xc0")
+	seed := common.HexToHash("0x5eed")
+	commitLog := func(t *testing.T, block uint64) types.Log {
+		return oracleLog(t, "CommitHash", block, testUser, hash, new(big.Int).SetUint64(block), big.NewInt(1700000000))
+	}
+	subscribeLog := func(t *testing.T, block uint64) types.Log {
+		return oracleLog(t, "Subscribe", block, testConsumer, testUser, hash, new(big.Int).SetUint64(block), big.NewInt(1700000010))
+	}
+
+	tests := []struct {
+		name string
+		// prepare sets up the store as it was before the commit was mined.
+		prepare    func(b db.Batch) error
+		head       uint64
+		history    bool
+		batches    func(t *testing.T) [][]types.Log
+		wantMark   bool
+		wantReveal bool
+	}{
+		{
+			name: "landed after the grace period",
+			prepare: func(b db.Batch) error {
+				// what reconcile leaves of a commit it took for a phantom.
+				if err := db.SetSeedHashAndSeed(b, hash[:], seed[:]); err != nil {
+					return err
+				}
+				return db.SetLifeError(b, hash[:], db.FeeCommit, "commit never landed")
+			},
+			head:       1000,
+			batches:    func(t *testing.T) [][]types.Log { return [][]types.Log{{commitLog(t, 990)}, {subscribeLog(t, 995)}} },
+			wantMark:   true,
+			wantReveal: true,
+		},
+		{
+			name: "landed late and subscribed in the same range",
+			prepare: func(b db.Batch) error {
+				return db.SetSeedHashAndSeed(b, hash[:], seed[:])
+			},
+			head:       1000,
+			batches:    func(t *testing.T) [][]types.Log { return [][]types.Log{{commitLog(t, 990), subscribeLog(t, 991)}} },
+			wantMark:   true,
+			wantReveal: true,
+		},
+		{
+			name: "landed in time",
+			prepare: func(b db.Batch) error {
+				if err := db.SetSeedHashAndSeed(b, hash[:], seed[:]); err != nil {
+					return err
+				}
+				return db.SetCommitted(b, hash[:], common.HexToHash("0x01").Bytes())
+			},
+			head:       1000,
+			batches:    func(t *testing.T) [][]types.Log { return [][]types.Log{{commitLog(t, 990)}, {subscribeLog(t, 995)}} },
+			wantMark:   true,
+			wantReveal: true,
+		},
+		{
+			name: "already revealed",
+			prepare: func(b db.Batch) error {
+				return db.SetRevealed(b, hash[:], seed[:], common.HexToHash("0x02").Bytes())
+			},
+			head:    1000,
+			batches: func(t *testing.T) [][]types.Log { return [][]types.Log{{commitLog(t, 990)}, {subscribeLog(t, 995)}} },
+		},
+		{
+			name:    "seed not known",
+			prepare: func(b db.Batch) error { return nil },
+			head:    1000,
+			batches: func(t *testing.T) [][]types.Log { return [][]types.Log{{commitLog(t, 990)}, {subscribeLog(t, 995)}} },
+		},
+		{
+			name: "replayed past its deadline",
+			prepare: func(b db.Batch) error {
+				return db.SetSeedHashAndSeed(b, hash[:], seed[:])
+			},
+			head:    990 + maxUnverifyBlock,
+			history: true,
+			batches: func(t *testing.T) [][]types.Log { return [][]types.Log{{commitLog(t, 990)}, {subscribeLog(t, 995)}} },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ldb, err := db.New(t.TempDir(), 16, 16)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ldb.Close()
+			if err := ldb.Update(tt.prepare); err != nil {
+				t.Fatal(err)
+			}
+			r := NewRegistry()
+			if err := RegisterOracleHandlers(r, testOracle, &fakeNode{}); err != nil {
+				t.Fatal(err)
+			}
+			work := &revealRecorder{}
+			pe := &PullEvent{ctx: context.Background(), ldb: ldb, user: testUser, oracle: testOracle, registry: r,
+				work: work, head: tt.head}
+			for _, logs := range tt.batches(t) {
+				if err := pe.apply(logs, logs[len(logs)-1].BlockNumber, tt.history); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := db.HasUnRevealSeed(ldb, hash[:]); got != tt.wantMark {
+				t.Fatalf("unrevealed mark %v, want %v", got, tt.wantMark)
+			}
+			if got := len(work.reveals) > 0; got != tt.wantReveal {
+				t.Fatalf("reveals %v, want reveal %v", work.reveals, tt.wantReveal)
+			}
+			l, _ := db.GetLifecycle(ldb, hash[:])
+			if l.CommitBlock != 990 {
+				t.Fatalf("commit block %d, want 990", l.CommitBlock)
+			}
+			if tt.wantMark && l.CommitError != "" {
+				t.Fatalf("commit error %q left on a commit that landed", l.CommitError)
+			}
+		})
+	}
+}
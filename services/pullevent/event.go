@@ -1,9 +0,0 @@
-package pullevent
-
-var (
-	EventSubscribe      = "0xb4d80af06c39f4ab03973a4e14cb9b17ab4213fa0d7bd904a5c7d6bf5d5716d7"
-	EventUnSubscribe    = "0x575cd5bf167e8f74f63163ab979775fe588116fc382a6cd1cc3b8bf76e07eacc"
-	EventCommitHash     = "0x09b2b06005aa246accb0fa2d5147d18a48b2580ebb471e3a669968562e0737e1"
-	EventRandomConsumed = "0xa6b50d46fd68ec1507309bfc0107c38fba251b3e06ad8a36416b1fb74e529bfe"
-	EventRevealSeed     = "0x0f55b32212e9b88d2bf9643f51936750a283fab160176b01c340af4ec1e85572"
-)
@@ -2,28 +2,26 @@ package pullevent
 
 import (
 	"context"
-	"github.com/astaxie/beego/logs"
+	"errors"
+	"fmt"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/hpb-project/srng-robot/config"
 	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/log"
+	"github.com/hpb-project/srng-robot/services/alert"
 	"github.com/hpb-project/srng-robot/utils"
-	"github.com/prometheus/common/log"
 	"math/big"
+	"sync"
 	"time"
 )
 
 const (
 	LastSyncBlockKey = "lastSyncBlock"
-)
 
-var (
-	bigOne     = big.NewInt(1)
-	bigTen     = big.NewInt(10)
-	bighundred = big.NewInt(100)
-	bigK       = big.NewInt(1000)
+	// maxUnverifyBlock is how many blocks a commit may wait for its reveal.
+	maxUnverifyBlock = 400
 )
 
 type Worker interface {
@@ -31,89 +29,250 @@ type Worker interface {
 	Reveal(commit []byte) error
 }
 
-type logHandler func(log types.Log, pe *PullEvent, addr common.Address, history bool) error
-
 type PullEvent struct {
 	ctx             context.Context
+	cancel          context.CancelFunc
 	client          *ethclient.Client
+	filterer        ethereum.LogFilterer // the log queries, client outside of tests
 	lastBlock       *big.Int
-	ldb             *db.LevelDB
+	ldb             db.Store
 	oracle          common.Address
 	user            common.Address
-	contractHandler logHandler
+	registry        *Registry
 	work 			Worker
+	head            uint64
+
+	// catch up sync, span is the current block range of one log query and
+	// spanOK counts the queries that succeeded with it.
+	workers int
+	span    uint64
+	spanOK  uint64
+	maxSpan uint64
+
+	deployBlock uint64
+	deployTx    string
+
+	rpcFailures int
 }
 
-func NewPullEvent(config config.Config, ldb *db.LevelDB, w Worker) *PullEvent {
+func NewPullEvent(config config.Config, ldb db.Store, w Worker) *PullEvent {
 	lastBlock := big.NewInt(0)
-	value, exist := ldb.Get([]byte(LastSyncBlockKey))
+	// a failing store must not look like a fresh one, that restarts the sync.
+	value, exist, err := ldb.Get([]byte(LastSyncBlockKey))
+	if err != nil {
+		log.Error("read sync cursor failed", "err", err)
+		return nil
+	}
 	if exist {
 		lastBlock.SetBytes(value)
 	}
 	client, err := ethclient.Dial(config.NodeRPC)
 	if err != nil {
-		logs.Error("pull event create client failed", "err", err)
+		log.Error("pull event create client failed", "err", err)
 		return nil
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 	pe := &PullEvent{
-		ctx:             context.Background(),
+		ctx:             ctx,
+		cancel:          cancel,
 		lastBlock:       lastBlock,
 		oracle:          common.HexToAddress(config.Oracle),
 		user:            utils.PrivkToAddress(config.PrivKey),
-		contractHandler: OracleContractHandler,
+		registry:        NewRegistry(),
 		client:          client,
+		filterer:        client,
 		ldb: ldb,
 		work: w,
+		deployBlock: config.DeployBlock,
+		deployTx: config.DeployTx,
+		workers: config.SyncWorkers,
+		span: config.SyncRange,
+		maxSpan: config.SyncRange,
+	}
+	if pe.workers < 1 {
+		pe.workers = 1
+	}
+	if pe.maxSpan == 0 {
+		pe.span, pe.maxSpan = 1000, 1000
+	}
+	if err := RegisterOracleHandlers(pe.registry, pe.oracle, client); err != nil {
+		log.Error("register oracle handlers failed", "err", err)
+		return nil
+	}
+	if config.Token != "" {
+		err := RegisterTokenHandlers(pe.registry, common.HexToAddress(config.Token), pe.user, pe.oracle,
+			common.HexToAddress(config.Deposit), client)
+		if err != nil {
+			log.Error("register token handlers failed", "err", err)
+			return nil
+		}
 	}
-	logs.Info("create pull evnet succeed")
+	log.Info("create pull evnet succeed")
 	return pe
 }
 
-func (p *PullEvent) GetLogs() {
-	query := ethereum.FilterQuery{}
-	query.FromBlock = p.lastBlock
-	query.ToBlock = new(big.Int).Add(p.lastBlock, big.NewInt(1))
-	query.Addresses = []common.Address{p.oracle}
+// Registry returns the event handler registry, handlers registered before
+// GetLogs runs see every synced log.
+func (p *PullEvent) Registry() *Registry {
+	return p.registry
+}
+
+// reveal hands commit to the worker, in history mode only while it can
+// still be revealed. block is the block the commit is known to exist at.
+func (p *PullEvent) reveal(commit []byte, block uint64, history bool) {
+	if p.work == nil {
+		return
+	}
+	if history {
+		if l, exist := db.GetLifecycle(p.ldb, commit); exist && l.CommitBlock > 0 {
+			block = l.CommitBlock
+		}
+		if block+maxUnverifyBlock <= p.head {
+			log.Info("skip reveal of expired commit", log.FieldCommit, common.BytesToHash(commit), log.FieldBlock, block)
+			return
+		}
+	}
+	p.work.Reveal(commit)
+}
 
-	if p.lastBlock.Int64() == 0 {
-		txhash := "0x0cce1507429f709fa77d8e59c795c5e67aa6e7f601f70ad249f97b38f9c681c0" // product contract
-		receipt,_ := p.client.TransactionReceipt(p.ctx, common.HexToHash(txhash))
-		p.lastBlock = receipt.BlockNumber
+// firstBlock returns the block a fresh database starts syncing from, the
+// configured deploy block or the block of the oracle deploy transaction, nil
+// if the sync was stopped while waiting for the node. Without either, or
+// with a node that doesn't know the deploy transaction, like one with a
+// limited tx index, it fails: a sync from genesis would take days.
+func (p *PullEvent) firstBlock() (*big.Int, error) {
+	if p.deployBlock > 0 {
+		return new(big.Int).SetUint64(p.deployBlock), nil
+	}
+	if p.deployTx == "" {
+		return nil, errors.New("no deployBlock or deployTx configured")
 	}
 	for {
-		query.FromBlock = p.lastBlock
+		receipt, err := p.client.TransactionReceipt(p.ctx, common.HexToHash(p.deployTx))
+		if err == nil && receipt != nil {
+			return receipt.BlockNumber, nil
+		}
+		if err == nil || errors.Is(err, ethereum.NotFound) {
+			return nil, fmt.Errorf("node doesn't know the oracle deploy tx %s, set deployBlock", p.deployTx)
+		}
+		log.Error("get oracle deploy receipt failed", "tx", p.deployTx, "err", err)
+		if !p.sleep(time.Second * 5) {
+			return nil, nil
+		}
+	}
+}
 
-		log.Info("start fileter start at ", p.lastBlock.Text(10))
-		history := false
+// sleep waits for d and reports false if the sync was stopped meanwhile.
+func (p *PullEvent) sleep(d time.Duration) bool {
+	select {
+	case <-p.ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// rpcFailed counts consecutive rpc errors and alerts once the node looks down.
+func (p *PullEvent) rpcFailed(err error) {
+	p.rpcFailures++
+	if p.rpcFailures >= config.Current().Alert.RPCFailures {
+		alert.Fire(alert.KindRPCOutage, alert.LevelCritical, "rpc", "%d rpc calls failed in a row, last error: %v",
+			p.rpcFailures, err)
+	}
+}
+
+// backfillIndexes rebuilds the revealed and tx indexes of a migrated store
+// by replaying the logs from first up to the sync cursor next, see
+// db.IndexBackfillPending. A failed backfill is tried again on the next start.
+func (p *PullEvent) backfillIndexes(first uint64, next uint64) {
+	if first < next {
+		log.Info("backfill indexes from oracle logs", "from", first, "to", next-1)
+		if _, err := p.Replay(p.ctx, first, next-1, true); err != nil {
+			log.Error("backfill indexes failed", "err", err)
+			return
+		}
+	}
+	if err := db.ClearIndexBackfill(p.ldb); err != nil {
+		log.Error("clear index backfill failed", "err", err)
+		return
+	}
+	log.Info("backfill indexes done")
+}
+
+// GetLogs syncs the oracle logs until stop is closed, it returns once the
+// running store writes are done. An error means the sync can't start.
+func (p *PullEvent) GetLogs(stop <-chan struct{}) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	go func() {
+		select {
+		case <-stop:
+			p.cancel()
+		case <-p.ctx.Done():
+		}
+	}()
+	backfill := db.IndexBackfillPending(p.ldb)
+	if p.lastBlock.Int64() == 0 || backfill {
+		first, err := p.firstBlock()
+		if err != nil {
+			p.cancel()
+			return err
+		}
+		if first == nil {
+			return nil
+		}
+		if p.lastBlock.Int64() == 0 {
+			p.lastBlock = first
+		}
+		if backfill {
+			next := p.lastBlock.Uint64()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p.backfillIndexes(first.Uint64(), next)
+			}()
+		}
+	}
+	for p.ctx.Err() == nil {
 		height, err := p.client.BlockNumber(p.ctx)
+		if err != nil {
+			p.rpcFailed(err)
+			p.sleep(time.Second)
+			continue
+		}
+		p.rpcFailures = 0
+		p.head = height
+		if lag := config.Current().Alert.MaxSyncLag; height > p.lastBlock.Uint64()+lag {
+			alert.Fire(alert.KindSyncLag, alert.LevelWarn, "sync", "event sync at block %s is %d blocks behind head %d",
+				p.lastBlock, height-p.lastBlock.Uint64(), height)
+		}
 		if height <= p.lastBlock.Uint64() {
-			time.Sleep(time.Second)
+			p.sleep(time.Second)
 			continue
-		} else if (height - 1000) >= p.lastBlock.Uint64() {
-			query.ToBlock = new(big.Int).Add(p.lastBlock, bigK)
-			history = true
-		} else if (height - 100) >= p.lastBlock.Uint64() {
-			query.ToBlock = new(big.Int).Add(p.lastBlock, bighundred)
-			history = true
-		} else if (height - 10) >= p.lastBlock.Uint64() {
-			query.ToBlock = new(big.Int).Add(p.lastBlock, bigTen)
-		} else {
-			query.ToBlock = new(big.Int).Add(p.lastBlock, bigOne)
-		}
-
-		allLogs, err := p.client.FilterLogs(p.ctx, query)
+		}
+		if height-p.lastBlock.Uint64() >= catchUpLag {
+			if err := p.catchUp(height); err != nil {
+				log.Error("catch up sync failed", log.FieldBlock, p.lastBlock, "err", err)
+				p.rpcFailed(err)
+				p.sleep(time.Second)
+			}
+			continue
+		}
+
+		from := p.lastBlock.Uint64()
+		log.Debug("start filter", log.FieldBlock, from, "to", height)
+		allLogs, err := p.filterLogs(p.ctx, from, height)
 		if err != nil {
-			log.Error("filter logs failed", err)
+			log.Error("filter logs failed", "err", err)
+			p.rpcFailed(err)
+			p.sleep(time.Second)
 			continue
 		}
-		if len(allLogs) > 0 {
-			for _, vlog := range allLogs {
-				if p.contractHandler != nil {
-					p.contractHandler(vlog, p, vlog.Address, history)
-				}
-			}
+		if err := p.apply(allLogs, height, false); err != nil {
+			log.Error("save synced logs failed", log.FieldBlock, from, "err", err)
+			p.sleep(time.Second)
+			continue
 		}
-		p.ldb.Set([]byte(LastSyncBlockKey), p.lastBlock.Bytes())
-		p.lastBlock = new(big.Int).Add(query.ToBlock, bigOne)
 	}
+	return nil
 }
@@ -0,0 +1,150 @@
+package pullevent
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/log"
+)
+
+// ErrorPolicy decides what a handler error does to the sync.
+type ErrorPolicy int
+
+const (
+	// PolicyBlock drops the whole block range and retries it, nothing of
+	// the range is written until every blocking handler succeeds.
+	PolicyBlock ErrorPolicy = iota
+	// PolicySkip logs the error and goes on with the next handler.
+	PolicySkip
+)
+
+// EventHandler processes one log of the event it was registered for, state
+// changes go into b which is written together with the sync height once the
+// whole block range is handled. history is true while catching up.
+type EventHandler func(log types.Log, pe *PullEvent, b db.Batch, history bool) error
+
+type registration struct {
+	name    string
+	event   string
+	policy  ErrorPolicy
+	handler EventHandler
+}
+
+// Registry routes logs to the handlers registered for their contract and
+// event, topics come from the contract abi.
+type Registry struct {
+	mu        sync.RWMutex
+	contracts map[common.Address]*abi.ABI
+	filters   map[common.Address][][][]common.Hash
+	handlers  map[common.Address]map[common.Hash][]registration
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		contracts: make(map[common.Address]*abi.ABI),
+		filters:   make(map[common.Address][][][]common.Hash),
+		handlers:  make(map[common.Address]map[common.Hash][]registration),
+	}
+}
+
+// AddContract makes the events of parsed available to handlers of addr and
+// adds addr to the synced contracts.
+func (r *Registry) AddContract(addr common.Address, parsed *abi.ABI) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.contracts[addr] = parsed
+	if _, exist := r.handlers[addr]; !exist {
+		r.handlers[addr] = make(map[common.Hash][]registration)
+	}
+}
+
+// AddFilteredContract is AddContract for a contract of which only the logs
+// matching one of the topic filters are synced, like the transfers of one
+// account.
+func (r *Registry) AddFilteredContract(addr common.Address, parsed *abi.ABI, topics ...[][]common.Hash) {
+	r.AddContract(addr, parsed)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.filters[addr] = append(r.filters[addr], topics...)
+}
+
+// Register adds handler for event of the contract at addr. Handlers of the
+// same log run in the order they were registered.
+func (r *Registry) Register(name string, addr common.Address, event string, policy ErrorPolicy, handler EventHandler) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	parsed, exist := r.contracts[addr]
+	if !exist {
+		return fmt.Errorf("contract %s not added", addr.Hex())
+	}
+	ev, exist := parsed.Events[event]
+	if !exist {
+		return fmt.Errorf("contract %s has no event %s", addr.Hex(), event)
+	}
+	r.handlers[addr][ev.ID] = append(r.handlers[addr][ev.ID], registration{name: name, event: event, policy: policy, handler: handler})
+	return nil
+}
+
+// Addresses returns the contracts to fetch logs of.
+func (r *Registry) Addresses() []common.Address {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]common.Address, 0, len(r.contracts))
+	for addr := range r.contracts {
+		list = append(list, addr)
+	}
+	return list
+}
+
+// Queries returns the log queries that cover the synced contracts in
+// [from, to], the logs of all contracts without filters are fetched at once.
+func (r *Registry) Queries(from *big.Int, to *big.Int) []ethereum.FilterQuery {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	all := ethereum.FilterQuery{FromBlock: from, ToBlock: to}
+	list := make([]ethereum.FilterQuery, 0, 1)
+	for addr := range r.contracts {
+		if len(r.filters[addr]) == 0 {
+			all.Addresses = append(all.Addresses, addr)
+		}
+	}
+	if len(all.Addresses) > 0 {
+		list = append(list, all)
+	}
+	for addr, filters := range r.filters {
+		for _, topics := range filters {
+			list = append(list, ethereum.FilterQuery{FromBlock: from, ToBlock: to,
+				Addresses: []common.Address{addr}, Topics: topics})
+		}
+	}
+	return list
+}
+
+// Dispatch runs every handler registered for l, the first error of a
+// blocking handler is returned.
+func (r *Registry) Dispatch(l types.Log, pe *PullEvent, b db.Batch, history bool) error {
+	if len(l.Topics) == 0 {
+		return nil
+	}
+	r.mu.RLock()
+	list := r.handlers[l.Address][l.Topics[0]]
+	r.mu.RUnlock()
+	for _, reg := range list {
+		err := reg.handler(l, pe, b, history)
+		if err == nil {
+			continue
+		}
+		if reg.policy == PolicyBlock {
+			return fmt.Errorf("handler %s of %s failed: %v", reg.name, reg.event, err)
+		}
+		log.Error("event handler failed, skip", "handler", reg.name, "event", reg.event,
+			log.FieldTx, l.TxHash, log.FieldBlock, l.BlockNumber, "err", err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package pullevent
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hpb-project/srng-robot/db"
+)
+
+const testABI = `[{"type":"event","name":"Ping","inputs":[]},{"type":"event","name":"Pong","inputs":[]}]`
+
+var (
+	testContract = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	otherAddress = common.HexToAddress("0x2000000000000000000000000000000000000002")
+)
+
+func testRegistry(t *testing.T) (*Registry, *abi.ABI) {
+	t.Helper()
+	parsed, err := abi.JSON(strings.NewReader(testABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry()
+	r.AddContract(testContract, &parsed)
+	return r, &parsed
+}
+
+func TestRegister(t *testing.T) {
+	r, _ := testRegistry(t)
+	noop := func(types.Log, *PullEvent, db.Batch, bool) error { return nil }
+	if err := r.Register("ping", testContract, "Ping", PolicyBlock, noop); err != nil {
+		t.Fatalf("register known event: %v", err)
+	}
+	if err := r.Register("ping", otherAddress, "Ping", PolicyBlock, noop); err == nil {
+		t.Fatal("register on a contract that wasn't added succeeded")
+	}
+	if err := r.Register("missing", testContract, "Missing", PolicyBlock, noop); err == nil {
+		t.Fatal("register of an event the abi doesn't have succeeded")
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	type handler struct {
+		name   string
+		event  string
+		policy ErrorPolicy
+		err    error
+	}
+	fail := errors.New("handler failed")
+	tests := []struct {
+		name     string
+		handlers []handler
+		address  common.Address
+		event    string // empty sends a log without topics
+		wantErr  bool
+		wantRuns []string
+	}{
+		{
+			name:    "no handlers",
+			address: testContract,
+			event:   "Ping",
+		},
+		{
+			name:     "handlers run in order",
+			handlers: []handler{{name: "a", event: "Ping"}, {name: "b", event: "Ping"}, {name: "c", event: "Ping"}},
+			address:  testContract,
+			event:    "Ping",
+			wantRuns: []string{"a", "b", "c"},
+		},
+		{
+			name:     "only handlers of the event run",
+			handlers: []handler{{name: "ping", event: "Ping"}, {name: "pong", event: "Pong"}},
+			address:  testContract,
+			event:    "Pong",
+			wantRuns: []string{"pong"},
+		},
+		{
+			name:     "log of another contract",
+			handlers: []handler{{name: "ping", event: "Ping"}},
+			address:  otherAddress,
+			event:    "Ping",
+		},
+		{
+			name:     "log without topics",
+			handlers: []handler{{name: "ping", event: "Ping"}},
+			address:  testContract,
+		},
+		{
+			name: "skip policy goes on",
+			handlers: []handler{{name: "a", event: "Ping", policy: PolicySkip, err: fail},
+				{name: "b", event: "Ping", policy: PolicyBlock}},
+			address:  testContract,
+			event:    "Ping",
+			wantRuns: []string{"a", "b"},
+		},
+		{
+			name: "block policy stops",
+			handlers: []handler{{name: "a", event: "Ping", policy: PolicyBlock, err: fail},
+				{name: "b", event: "Ping", policy: PolicyBlock}},
+			address:  testContract,
+			event:    "Ping",
+			wantErr:  true,
+			wantRuns: []string{"a"},
+		},
+		{
+			name: "block after skip",
+			handlers: []handler{{name: "a", event: "Ping", policy: PolicySkip, err: fail},
+				{name: "b", event: "Ping", policy: PolicyBlock, err: fail}, {name: "c", event: "Ping"}},
+			address:  testContract,
+			event:    "Ping",
+			wantErr:  true,
+			wantRuns: []string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, parsed := testRegistry(t)
+			var runs []string
+			for _, h := range tt.handlers {
+				h := h
+				err := r.Register(h.name, testContract, h.event, h.policy, func(types.Log, *PullEvent, db.Batch, bool) error {
+					runs = append(runs, h.name)
+					return h.err
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			l := types.Log{Address: tt.address}
+			if tt.event != "" {
+				l.Topics = []common.Hash{parsed.Events[tt.event].ID}
+			}
+			err := r.Dispatch(l, nil, nil, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Dispatch error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(runs, tt.wantRuns) {
+				t.Fatalf("handlers run %v, want %v", runs, tt.wantRuns)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package pullevent
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/log"
+)
+
+// ReplayChange is a store write a replay made or, in dry-run, would make.
+type ReplayChange struct {
+	Block uint64 `json:"block"`
+	Key   string `json:"key"`
+	Op    string `json:"op"`
+	Value string `json:"value,omitempty"`
+}
+
+// ReplayResult is the outcome of one replay.
+type ReplayResult struct {
+	From    uint64         `json:"from"`
+	To      uint64         `json:"to"`
+	Apply   bool           `json:"apply"`
+	Logs    int            `json:"logs"`
+	Changes []ReplayChange `json:"changes"`
+}
+
+// Replay scans the logs in [from, to] again and runs them through the
+// registered handlers in history mode. Without apply nothing is written and
+// the changes the handlers would make are returned, with apply the changes of
+// every fetched range are written at once. The sync cursor is left alone, so
+// a replay can run next to the live sync.
+func (p *PullEvent) Replay(ctx context.Context, from uint64, to uint64, apply bool) (*ReplayResult, error) {
+	if from > to {
+		return nil, errors.New("from is after to")
+	}
+	head, err := p.client.BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if to > head {
+		return nil, fmt.Errorf("to is after the chain head %d", head)
+	}
+	rp := p.replayer(ctx, head, apply)
+	result := &ReplayResult{From: from, To: to, Apply: apply, Changes: make([]ReplayChange, 0)}
+	for start := from; start <= to; start += rp.maxSpan {
+		end := start + rp.maxSpan - 1
+		if end > to {
+			end = to
+		}
+		list, err := rp.fetch(ctx, start, end)
+		if err != nil {
+			return result, fmt.Errorf("filter logs %d-%d failed: %v", start, end, err)
+		}
+		log.Info("replay logs", "from", start, "to", end, "count", len(list), "apply", apply)
+		var changes []ReplayChange
+		handle := func(b db.Batch) error {
+			rb := &replayBatch{Batch: b, ldb: rp.ldb}
+			for _, vlog := range list {
+				rb.block = vlog.BlockNumber
+				if err := rp.registry.Dispatch(vlog, rp, rb, true); err != nil {
+					return err
+				}
+			}
+			changes = rb.changes
+			return nil
+		}
+		if apply {
+			err = rp.ldb.Update(handle)
+		} else {
+			err = handle(rp.ldb.NewBatch())
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Logs += len(list)
+		result.Changes = append(result.Changes, changes...)
+	}
+	return result, nil
+}
+
+// replayer returns a PullEvent for a replay that shares the store, client
+// and handlers with p but none of the state the live sync writes. Dry-run has
+// no worker so handlers can't trigger reveals.
+func (p *PullEvent) replayer(ctx context.Context, head uint64, apply bool) *PullEvent {
+	rp := &PullEvent{
+		ctx:      ctx,
+		client:   p.client,
+		filterer: p.filterer,
+		ldb:      p.ldb,
+		oracle:   p.oracle,
+		user:     p.user,
+		registry: p.registry,
+		head:     head,
+		workers:  1,
+		span:     p.maxSpan,
+		maxSpan:  p.maxSpan,
+	}
+	if apply {
+		rp.work = p.work
+	}
+	return rp
+}
+
+// replayBatch records the writes that change the store.
+type replayBatch struct {
+	db.Batch
+	ldb     db.Store
+	block   uint64
+	changes []ReplayChange
+}
+
+func (b *replayBatch) Set(key interface{}, value []byte) error {
+	old, exist, err := b.ldb.Get(key)
+	if err != nil {
+		return err
+	}
+	if !exist || !bytes.Equal(old, value) {
+		b.changes = append(b.changes, ReplayChange{Block: b.block, Key: printKey(key.([]byte)), Op: "set",
+			Value: printValue(value)})
+	}
+	return b.Batch.Set(key, value)
+}
+
+func (b *replayBatch) Delete(key interface{}) error {
+	if exist, _ := b.ldb.Has(key); exist {
+		b.changes = append(b.changes, ReplayChange{Block: b.block, Key: printKey(key.([]byte)), Op: "delete"})
+	}
+	return b.Batch.Delete(key)
+}
+
+// printKey shows the text prefix of a key as is and the hash after it as
+// hex, keys end with a 32 byte hash or a short suffix after one.
+func printKey(key []byte) string {
+	i, max := 0, len(key)
+	if max > 32 {
+		max -= 32
+	}
+	for i < max && key[i] >= 'a' && key[i] <= 'z' {
+		i++
+	}
+	if i == len(key) {
+		return string(key)
+	}
+	return string(key[:i]) + ":0x" + hex.EncodeToString(key[i:])
+}
+
+// printValue shows json and text values as is and others as hex.
+func printValue(value []byte) string {
+	if utf8.Valid(value) && bytes.IndexFunc(value, func(r rune) bool { return !unicode.IsPrint(r) }) < 0 {
+		return string(value)
+	}
+	return "0x" + hex.EncodeToString(value)
+}
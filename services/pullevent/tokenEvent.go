@@ -0,0 +1,91 @@
+package pullevent
+
+import (
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hpb-project/srng-robot/contracts"
+	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/log"
+)
+
+// tokenHandlers books the HRG transfers and approvals of the committer,
+// the kind of a transfer follows from its counterparty.
+type tokenHandlers struct {
+	filter  *contracts.TokenFilterer
+	user    common.Address
+	oracle  common.Address
+	deposit common.Address
+}
+
+// RegisterTokenHandlers adds the HRG token at addr to r, only logs that
+// involve user are synced. deposit may be the zero address when the deposit
+// contract isn't known, the oracle holds the deposits then.
+func RegisterTokenHandlers(r *Registry, addr common.Address, user common.Address, oracle common.Address,
+	deposit common.Address, backend bind.ContractFilterer) error {
+	parsed, err := contracts.TokenMetaData.GetAbi()
+	if err != nil {
+		return err
+	}
+	filter, err := contracts.NewTokenFilterer(addr, backend)
+	if err != nil {
+		return err
+	}
+	transfer, approval := parsed.Events["Transfer"].ID, parsed.Events["Approval"].ID
+	account := common.BytesToHash(user.Bytes())
+	r.AddFilteredContract(addr, parsed,
+		[][]common.Hash{{transfer, approval}, {account}},
+		[][]common.Hash{{transfer}, nil, {account}})
+	h := &tokenHandlers{filter: filter, user: user, oracle: oracle, deposit: deposit}
+	if err := r.Register("token.Transfer", addr, "Transfer", PolicyBlock, h.transfer); err != nil {
+		return err
+	}
+	return r.Register("token.Approval", addr, "Approval", PolicyBlock, h.approval)
+}
+
+func (h *tokenHandlers) kind(from common.Address, to common.Address) string {
+	noDeposit := h.deposit == (common.Address{})
+	switch {
+	case from == h.user && !noDeposit && to == h.deposit:
+		return db.HRGDeposit
+	case from == h.user && to == h.oracle && noDeposit:
+		return db.HRGDeposit
+	case from == h.user && to == h.oracle:
+		return db.HRGFee
+	case from == h.user:
+		return db.HRGOut
+	case !noDeposit && from == h.deposit:
+		return db.HRGRefund
+	case from == h.oracle:
+		return db.HRGReward
+	}
+	return db.HRGIn
+}
+
+func (h *tokenHandlers) transfer(vLog types.Log, pe *PullEvent, b db.Batch, history bool) error {
+	ev, err := h.filter.ParseTransfer(vLog)
+	if err != nil {
+		return err
+	}
+	if ev.From != h.user && ev.To != h.user {
+		return nil
+	}
+	kind := h.kind(ev.From, ev.To)
+	log.Info("got hrg transfer", "kind", kind, "from", ev.From, "to", ev.To, "value", ev.Value,
+		log.FieldTx, vLog.TxHash, log.FieldBlock, vLog.BlockNumber)
+	return db.SetTokenEntry(b, db.TokenEntry{Block: vLog.BlockNumber, LogIndex: vLog.Index, TxHash: vLog.TxHash.Hex(),
+		Event: db.TokenTransfer, Kind: kind, From: ev.From.Hex(), To: ev.To.Hex(), Value: ev.Value.String()})
+}
+
+func (h *tokenHandlers) approval(vLog types.Log, pe *PullEvent, b db.Batch, history bool) error {
+	ev, err := h.filter.ParseApproval(vLog)
+	if err != nil {
+		return err
+	}
+	if ev.Owner != h.user {
+		return nil
+	}
+	log.Info("got hrg approval", "spender", ev.Spender, "value", ev.Value, log.FieldTx, vLog.TxHash, log.FieldBlock, vLog.BlockNumber)
+	return db.SetTokenEntry(b, db.TokenEntry{Block: vLog.BlockNumber, LogIndex: vLog.Index, TxHash: vLog.TxHash.Hex(),
+		Event: db.TokenApproval, Kind: db.HRGApproval, From: ev.Owner.Hex(), To: ev.Spender.Hex(), Value: ev.Value.String()})
+}
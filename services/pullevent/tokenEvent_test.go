@@ -0,0 +1,34 @@
+package pullevent
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hpb-project/srng-robot/db"
+)
+
+func TestTransferKind(t *testing.T) {
+	deposit := common.HexToAddress("0x6000000000000000000000000000000000000006")
+	stranger := common.HexToAddress("0x7000000000000000000000000000000000000007")
+	tests := []struct {
+		name     string
+		deposit  common.Address
+		from, to common.Address
+		want     string
+	}{
+		{"to deposit contract", deposit, testUser, deposit, db.HRGDeposit},
+		{"from deposit contract", deposit, deposit, testUser, db.HRGRefund},
+		{"to oracle", deposit, testUser, testOracle, db.HRGFee},
+		{"from oracle", deposit, testOracle, testUser, db.HRGReward},
+		{"to oracle without deposit contract", common.Address{}, testUser, testOracle, db.HRGDeposit},
+		{"from oracle without deposit contract", common.Address{}, testOracle, testUser, db.HRGReward},
+		{"to anyone", deposit, testUser, stranger, db.HRGOut},
+		{"from anyone", common.Address{}, stranger, testUser, db.HRGIn},
+	}
+	for _, tt := range tests {
+		h := &tokenHandlers{user: testUser, oracle: testOracle, deposit: tt.deposit}
+		if got := h.kind(tt.from, tt.to); got != tt.want {
+			t.Errorf("%s: kind = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
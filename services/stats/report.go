@@ -0,0 +1,201 @@
+package stats
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hpb-project/srng-robot/db"
+)
+
+const dayFormat = "2006-01-02"
+
+// Day aggregates the commits made on one UTC day. Subscriptions, reveals,
+// expiries and fees are counted on the day of the commit they belong to, so
+// SubscriptionRate is the share of that day's commits that got used.
+// HRGSpent sums the deposits and fees paid and HRGEarned the refunds and
+// rewards received, taken from the token ledger and booked on the day of
+// their commit like the fees.
+type Day struct {
+	Date             string  `json:"date"`
+	Commits          int     `json:"commits"`
+	Subscribed       int     `json:"subscribed"`
+	Revealed         int     `json:"revealed"`
+	Expired          int     `json:"expired"`
+	SubscriptionRate float64 `json:"subscriptionRate"`
+	AvgRevealSeconds float64 `json:"avgRevealSeconds"`
+	HPBFee           string  `json:"hpbFee"`
+	HRGSpent         string  `json:"hrgSpent"`
+	HRGEarned        string  `json:"hrgEarned"`
+	ValidCount       string  `json:"validCount,omitempty"`
+
+	revealDelay int64
+	revealCount int
+	fee         *big.Int
+	spent       *big.Int
+	earned      *big.Int
+}
+
+type Report struct {
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	Total       Day       `json:"total"`
+	Days        []Day     `json:"days"`
+}
+
+func newDay(date string) *Day {
+	return &Day{Date: date, fee: new(big.Int), spent: new(big.Int), earned: new(big.Int)}
+}
+
+func (d *Day) add(o *Day) {
+	d.Commits += o.Commits
+	d.Subscribed += o.Subscribed
+	d.Revealed += o.Revealed
+	d.Expired += o.Expired
+	d.revealDelay += o.revealDelay
+	d.revealCount += o.revealCount
+	d.fee.Add(d.fee, o.fee)
+	d.spent.Add(d.spent, o.spent)
+	d.earned.Add(d.earned, o.earned)
+}
+
+func (d *Day) finish() {
+	if d.Commits > 0 {
+		d.SubscriptionRate = float64(d.Subscribed) / float64(d.Commits)
+	}
+	if d.revealCount > 0 {
+		d.AvgRevealSeconds = float64(d.revealDelay) / float64(d.revealCount)
+	}
+	d.HPBFee = d.fee.String()
+	d.HRGSpent = d.spent.String()
+	d.HRGEarned = d.earned.String()
+}
+
+func parseWei(v string) *big.Int {
+	n, ok := new(big.Int).SetString(v, 10)
+	if !ok {
+		return new(big.Int)
+	}
+	return n
+}
+
+// LastDays returns the range covering today and the days-1 days before it.
+func LastDays(days int) (time.Time, time.Time) {
+	now := time.Now().UTC()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+	return to.AddDate(0, 0, -days), to
+}
+
+// Build makes the daily report of the commits made in [from, to).
+func Build(ldb db.Store, from time.Time, to time.Time) *Report {
+	days := make(map[string]*Day)
+	day := func(unix int64) *Day {
+		date := time.Unix(unix, 0).UTC().Format(dayFormat)
+		d, exist := days[date]
+		if !exist {
+			d = newDay(date)
+			days[date] = d
+		}
+		return d
+	}
+	inRange := func(unix int64) bool {
+		return unix >= from.Unix() && unix < to.Unix()
+	}
+
+	lifecycles := db.GetAllLifecycles(ldb)
+	for _, l := range lifecycles {
+		if !inRange(int64(l.CommitTime)) {
+			continue
+		}
+		d := day(int64(l.CommitTime))
+		d.Commits++
+		if l.SubBlock != 0 {
+			d.Subscribed++
+		}
+		if l.RevealBlock != 0 {
+			d.Revealed++
+			if l.SubTime != 0 && l.RevealTime >= l.SubTime {
+				d.revealDelay += int64(l.RevealTime - l.SubTime)
+				d.revealCount++
+			}
+		} else if l.ExpiredBlock != 0 {
+			d.Expired++
+		}
+		d.fee.Add(d.fee, parseWei(l.CommitFee))
+		d.fee.Add(d.fee, parseWei(l.RevealFee))
+	}
+
+	snapshots := db.GetSnapshots(ldb)
+	for _, s := range snapshots {
+		if inRange(s.Time) {
+			day(s.Time).ValidCount = s.ValidCount
+		}
+	}
+
+	commitTimes := make(map[string]int64, len(lifecycles))
+	for _, l := range lifecycles {
+		commitTimes[l.Hash] = int64(l.CommitTime)
+	}
+	for _, e := range db.GetTokenEntries(ldb) {
+		if e.Event != db.TokenTransfer {
+			continue
+		}
+		unix, exist := commitTimes[e.Commit]
+		if !exist {
+			unix = blockTime(snapshots, e.Block)
+		}
+		if !inRange(unix) {
+			continue
+		}
+		switch e.Kind {
+		case db.HRGDeposit, db.HRGFee:
+			d := day(unix)
+			d.spent.Add(d.spent, parseWei(e.Value))
+		case db.HRGRefund, db.HRGReward:
+			d := day(unix)
+			d.earned.Add(d.earned, parseWei(e.Value))
+		}
+	}
+
+	report := &Report{From: from.UTC().Format(dayFormat), To: to.UTC().Format(dayFormat),
+		GeneratedAt: time.Now().UTC(), Days: make([]Day, 0, len(days))}
+	total := newDay("total")
+	for _, d := range days {
+		total.add(d)
+		d.finish()
+		report.Days = append(report.Days, *d)
+	}
+	total.finish()
+	report.Total = *total
+	sort.Slice(report.Days, func(i, j int) bool { return report.Days[i].Date < report.Days[j].Date })
+	return report
+}
+
+// blockTime estimates the time of block by the first snapshot taken at or
+// after it, blocks after the last snapshot are recent.
+func blockTime(snapshots []db.Snapshot, block uint64) int64 {
+	i := sort.Search(len(snapshots), func(i int) bool { return snapshots[i].Block >= block })
+	if i == len(snapshots) {
+		return time.Now().Unix()
+	}
+	return snapshots[i].Time
+}
+
+// WriteCSV writes one row per day followed by the total row.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "commits", "subscribed", "revealed", "expired", "subscription_rate",
+		"avg_reveal_seconds", "hpb_fee", "hrg_spent", "hrg_earned", "valid_count"})
+	for _, d := range append(r.Days, r.Total) {
+		cw.Write([]string{d.Date, strconv.Itoa(d.Commits), strconv.Itoa(d.Subscribed), strconv.Itoa(d.Revealed),
+			strconv.Itoa(d.Expired), fmt.Sprintf("%.4f", d.SubscriptionRate), fmt.Sprintf("%.1f", d.AvgRevealSeconds),
+			d.HPBFee, d.HRGSpent, d.HRGEarned, d.ValidCount})
+	}
+	cw.Flush()
+	return cw.Error()
+}
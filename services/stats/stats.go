@@ -0,0 +1,136 @@
+package stats
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/hpb-project/srng-robot/config"
+	"github.com/hpb-project/srng-robot/contracts"
+	"github.com/hpb-project/srng-robot/db"
+	"github.com/hpb-project/srng-robot/log"
+)
+
+// Collector samples the oracle statistics of the committer into the store,
+// the reports are built from these snapshots and the local lifecycles.
+type Collector struct {
+	client *ethclient.Client
+	oracle *contracts.Oracle
+	token  *contracts.Token
+	user   common.Address
+	ldb    db.Store
+
+	isLeader func() bool
+}
+
+func NewCollector(client *ethclient.Client, conf config.Config, user common.Address, ldb db.Store) (*Collector, error) {
+	oracle, err := contracts.NewOracle(common.HexToAddress(conf.Oracle), client)
+	if err != nil {
+		return nil, err
+	}
+	token, err := contracts.NewToken(common.HexToAddress(conf.Token), client)
+	if err != nil {
+		return nil, err
+	}
+	return &Collector{client: client, oracle: oracle, token: token, user: user, ldb: ldb,
+		isLeader: func() bool { return true }}, nil
+}
+
+// SetLeaderCheck makes only the leader take snapshots, so instances sharing
+// a store don't record the same sample twice.
+func (c *Collector) SetLeaderCheck(isLeader func() bool) {
+	c.isLeader = isLeader
+}
+
+// Snapshot takes one sample and stores it.
+func (c *Collector) Snapshot(ctx context.Context) (db.Snapshot, error) {
+	s := db.Snapshot{Time: time.Now().Unix()}
+	block, err := c.client.BlockNumber(ctx)
+	if err != nil {
+		return s, err
+	}
+	s.Block = block
+	opts := &bind.CallOpts{Context: ctx}
+
+	valid, err := c.oracle.GetCommiterValidCount(opts, c.user)
+	if err != nil {
+		return s, err
+	}
+	s.ValidCount = valid.String()
+	consumed, err := db.CountConsumed(c.ldb)
+	if err != nil {
+		return s, err
+	}
+	s.ConsumedCount = strconv.Itoa(consumed)
+	t0, t1, t2, err := c.oracle.GetTotalStat(opts)
+	if err != nil {
+		return s, err
+	}
+	s.TotalStat = [3]string{t0.String(), t1.String(), t2.String()}
+	commits, err := c.oracle.GetUserCommitsList(opts, c.user)
+	if err != nil {
+		return s, err
+	}
+	s.Commits = len(commits)
+	unverified, err := c.oracle.GetUserUnverifiedList(opts, c.user)
+	if err != nil {
+		return s, err
+	}
+	s.Unverified = len(unverified)
+
+	balance, err := c.client.BalanceAt(ctx, c.user, nil)
+	if err != nil {
+		return s, err
+	}
+	s.HPBBalance = balance.String()
+	tokenBalance, err := c.token.BalanceOf(opts, c.user)
+	if err != nil {
+		return s, err
+	}
+	s.HRGBalance = tokenBalance.String()
+
+	return s, db.SetSnapshot(c.ldb, s)
+}
+
+// Run takes a snapshot every StatsInterval until stop is closed, snapshots
+// older than StatsRetention are deleted.
+func (c *Collector) Run(stop <-chan struct{}) {
+	changed := config.Changed()
+	interval := config.Current().StatsInterval
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-changed:
+			changed = config.Changed()
+			if next := config.Current().StatsInterval; next != interval {
+				interval = next
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(interval)
+			}
+		case <-timer.C:
+			if c.isLeader() {
+				if s, err := c.Snapshot(context.Background()); err != nil {
+					log.Error("take stats snapshot failed", "err", err)
+				} else {
+					log.Debug("took stats snapshot", "block", s.Block, "valid", s.ValidCount, "commits", s.Commits)
+				}
+				before := time.Now().Add(-config.Current().StatsRetention).Unix()
+				if count, err := db.PruneSnapshots(c.ldb, before); err != nil {
+					log.Error("prune stats snapshots failed", "err", err)
+				} else if count > 0 {
+					log.Info("pruned stats snapshots", "count", count)
+				}
+			}
+			interval = config.Current().StatsInterval
+			timer.Reset(interval)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package verifier
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/hpb-project/srng-robot/contracts"
+	"github.com/hpb-project/srng-robot/log"
+)
+
+const (
+	FindingMismatch   = "hash_mismatch"
+	FindingLate       = "late_reveal"
+	FindingUnrevealed = "unrevealed_subscription"
+	FindingNoCommit   = "reveal_without_commit"
+	FindingRandom     = "random_mismatch"
+
+	// MaxUnverifyBlock is how many blocks a commit may wait for its reveal.
+	MaxUnverifyBlock = 400
+)
+
+// SeedHash is the commit of seed as the oracle computes it in getHash.
+func SeedHash(seed [32]byte) [32]byte {
+	return crypto.Keccak256Hash(seed[:])
+}
+
+// SeedRandom is the random the oracle returns in getRandom for a commit
+// revealed with seed, hrandom is the hardware random the chain stored with
+// the commit.
+func SeedRandom(seed [32]byte, hrandom [32]byte) [32]byte {
+	return crypto.Keccak256Hash(seed[:], hrandom[:])
+}
+
+type CommitRecord struct {
+	Hash        string `json:"hash"`
+	Commiter    string `json:"commiter"`
+	CommitBlock uint64 `json:"commitBlock"`
+	CommitTx    string `json:"commitTx"`
+	Consumer    string `json:"consumer,omitempty"`
+	SubBlock    uint64 `json:"subscribeBlock,omitempty"`
+	Seed        string `json:"seed,omitempty"`
+	RevealBlock uint64 `json:"revealBlock,omitempty"`
+	RevealTx    string `json:"revealTx,omitempty"`
+	Valid       *bool  `json:"valid,omitempty"`
+	Random      string `json:"random,omitempty"`
+	RandomValid *bool  `json:"randomValid,omitempty"`
+}
+
+type Finding struct {
+	Kind     string `json:"kind"`
+	Hash     string `json:"hash"`
+	Commiter string `json:"commiter"`
+	Block    uint64 `json:"block"`
+	Detail   string `json:"detail"`
+}
+
+type Stats struct {
+	Commits    int `json:"commits"`
+	Subscribed int `json:"subscribed"`
+	Revealed   int `json:"revealed"`
+	Mismatches int `json:"mismatches"`
+	Late       int `json:"late"`
+	Unrevealed int `json:"unrevealed"`
+	NoCommit   int `json:"revealWithoutCommit"`
+	// RandomMismatches is only counted with Random set.
+	RandomMismatches int `json:"randomMismatches"`
+}
+
+// Report is the published result of one scan.
+type Report struct {
+	Oracle      string         `json:"oracle"`
+	Commiter    string         `json:"commiter,omitempty"`
+	FromBlock   uint64         `json:"fromBlock"`
+	ToBlock     uint64         `json:"toBlock"`
+	GeneratedAt time.Time      `json:"generatedAt"`
+	Stats       Stats          `json:"stats"`
+	Findings    []Finding      `json:"findings"`
+	Commits     []CommitRecord `json:"commits"`
+}
+
+type Verifier struct {
+	client *ethclient.Client
+	oracle *contracts.Oracle
+	addr   common.Address
+	abi    *abi.ABI
+
+	// Step is the block range of one log query.
+	Step uint64
+	// Random makes the verifier fetch getRandom of every revealed commit and
+	// check it against SeedRandom.
+	Random bool
+}
+
+func NewVerifier(client *ethclient.Client, oracle common.Address) (*Verifier, error) {
+	instance, err := contracts.NewOracle(oracle, client)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := contracts.OracleMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{client: client, oracle: instance, addr: oracle, abi: parsed, Step: 2000}, nil
+}
+
+// Calibrate checks once that SeedHash matches the getHash of the oracle,
+// the scan itself verifies seeds without rpc calls.
+func (v *Verifier) Calibrate(ctx context.Context) error {
+	var seed [32]byte
+	copy(seed[:], crypto.Keccak256([]byte(time.Now().String())))
+	remote, err := v.oracle.GetHash(&bind.CallOpts{Context: ctx}, seed)
+	if err != nil {
+		return err
+	}
+	if remote != SeedHash(seed) {
+		return errors.New("local seed hash differs from oracle getHash, the verifier can't be used with this oracle")
+	}
+	return nil
+}
+
+// Scan verifies the commits and reveals in [from, to], commiter limits the
+// scan to one committer when it is not nil.
+func (v *Verifier) Scan(ctx context.Context, from uint64, to uint64, commiter *common.Address) (*Report, error) {
+	report := &Report{Oracle: v.addr.Hex(), FromBlock: from, ToBlock: to, GeneratedAt: time.Now().UTC(),
+		Findings: make([]Finding, 0), Commits: make([]CommitRecord, 0)}
+	if v.Step < 1 {
+		return nil, errors.New("step must be at least 1")
+	}
+	if commiter != nil {
+		report.Commiter = commiter.Hex()
+	}
+	topics := []common.Hash{v.abi.Events["CommitHash"].ID, v.abi.Events["Subscribe"].ID, v.abi.Events["RevealSeed"].ID}
+	records := make(map[[32]byte]*CommitRecord)
+	order := make([][32]byte, 0)
+
+	for start := from; start <= to; start += v.Step {
+		end := start + v.Step - 1
+		if end > to {
+			end = to
+		}
+		list, err := v.client.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(start),
+			ToBlock:   new(big.Int).SetUint64(end),
+			Addresses: []common.Address{v.addr},
+			Topics:    [][]common.Hash{topics},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("filter logs %d-%d failed: %v", start, end, err)
+		}
+		log.Info("verify logs", "from", start, "to", end, "count", len(list))
+		for _, l := range list {
+			if err := v.apply(report, records, &order, l, commiter); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, h := range order {
+		r := records[h]
+		if r.Seed != "" || r.Consumer == "" {
+			continue
+		}
+		if r.CommitBlock+MaxUnverifyBlock <= to {
+			report.Stats.Unrevealed++
+			report.Findings = append(report.Findings, Finding{Kind: FindingUnrevealed, Hash: r.Hash, Commiter: r.Commiter,
+				Block: r.SubBlock, Detail: fmt.Sprintf("subscribed by %s but not revealed before block %d", r.Consumer, r.CommitBlock+MaxUnverifyBlock)})
+		}
+	}
+	if v.Random {
+		if err := v.checkRandom(ctx, report, records, order); err != nil {
+			return nil, err
+		}
+	}
+	for _, h := range order {
+		report.Commits = append(report.Commits, *records[h])
+	}
+	sort.SliceStable(report.Findings, func(i, j int) bool { return report.Findings[i].Block < report.Findings[j].Block })
+	return report, nil
+}
+
+// checkRandom fetches getRandom of every revealed commit and compares it with
+// the random recomputed from the revealed seed and the hrandom of the commit.
+func (v *Verifier) checkRandom(ctx context.Context, report *Report, records map[[32]byte]*CommitRecord, order [][32]byte) error {
+	// hrandom of the commits of each committer, loaded once per committer.
+	hrandoms := make(map[string]map[[32]byte][32]byte)
+	for _, h := range order {
+		r := records[h]
+		if r.Seed == "" {
+			continue
+		}
+		random, err := v.oracle.GetRandom(&bind.CallOpts{Context: ctx}, h)
+		if err != nil {
+			return err
+		}
+		r.Random = "0x" + hex.EncodeToString(random[:])
+
+		commits, exist := hrandoms[r.Commiter]
+		if !exist {
+			list, err := v.oracle.GetUserCommitsList(&bind.CallOpts{Context: ctx}, common.HexToAddress(r.Commiter))
+			if err != nil {
+				return err
+			}
+			commits = make(map[[32]byte][32]byte, len(list))
+			for _, c := range list {
+				commits[c.Commit] = c.Hrandom
+			}
+			hrandoms[r.Commiter] = commits
+		}
+		hrandom, exist := commits[h]
+		if !exist {
+			log.Warn("revealed commit missing from the committer list", "commiter", r.Commiter, log.FieldCommit, r.Hash)
+			continue
+		}
+		var seed [32]byte
+		copy(seed[:], common.FromHex(r.Seed))
+		valid := SeedRandom(seed, hrandom) == random
+		r.RandomValid = &valid
+		if !valid {
+			report.Stats.RandomMismatches++
+			report.Findings = append(report.Findings, Finding{Kind: FindingRandom, Hash: r.Hash, Commiter: r.Commiter,
+				Block: r.RevealBlock, Detail: "getRandom doesn't follow from the revealed seed"})
+		}
+	}
+	return nil
+}
+
+func (v *Verifier) apply(report *Report, records map[[32]byte]*CommitRecord, order *[][32]byte, l types.Log, commiter *common.Address) error {
+	switch l.Topics[0] {
+	case v.abi.Events["CommitHash"].ID:
+		ev, err := v.oracle.ParseCommitHash(l)
+		if err != nil {
+			return err
+		}
+		if commiter != nil && ev.Sender != *commiter {
+			return nil
+		}
+		records[ev.Hash] = &CommitRecord{Hash: "0x" + hex.EncodeToString(ev.Hash[:]), Commiter: ev.Sender.Hex(),
+			CommitBlock: l.BlockNumber, CommitTx: l.TxHash.Hex()}
+		*order = append(*order, ev.Hash)
+		report.Stats.Commits++
+
+	case v.abi.Events["Subscribe"].ID:
+		ev, err := v.oracle.ParseSubscribe(l)
+		if err != nil {
+			return err
+		}
+		r, exist := records[ev.Hash]
+		if !exist {
+			return nil
+		}
+		r.Consumer = ev.Consumer.Hex()
+		r.SubBlock = l.BlockNumber
+		report.Stats.Subscribed++
+
+	case v.abi.Events["RevealSeed"].ID:
+		ev, err := v.oracle.ParseRevealSeed(l)
+		if err != nil {
+			return err
+		}
+		if commiter != nil && ev.Commiter != *commiter {
+			return nil
+		}
+		hash := "0x" + hex.EncodeToString(ev.Hash[:])
+		r, exist := records[ev.Hash]
+		if !exist {
+			// committed before the scanned range.
+			report.Stats.NoCommit++
+			report.Findings = append(report.Findings, Finding{Kind: FindingNoCommit, Hash: hash, Commiter: ev.Commiter.Hex(),
+				Block: l.BlockNumber, Detail: "commit not in scanned range, seed checked only"})
+			r = &CommitRecord{Hash: hash, Commiter: ev.Commiter.Hex()}
+			records[ev.Hash] = r
+			*order = append(*order, ev.Hash)
+		}
+		r.Seed = "0x" + hex.EncodeToString(ev.Seed[:])
+		r.RevealBlock = l.BlockNumber
+		r.RevealTx = l.TxHash.Hex()
+		valid := SeedHash(ev.Seed) == ev.Hash
+		r.Valid = &valid
+		report.Stats.Revealed++
+		if !valid {
+			report.Stats.Mismatches++
+			report.Findings = append(report.Findings, Finding{Kind: FindingMismatch, Hash: hash, Commiter: r.Commiter,
+				Block: l.BlockNumber, Detail: "revealed seed doesn't hash to the commit"})
+		}
+		if r.CommitBlock != 0 && l.BlockNumber > r.CommitBlock+MaxUnverifyBlock {
+			report.Stats.Late++
+			report.Findings = append(report.Findings, Finding{Kind: FindingLate, Hash: hash, Commiter: r.Commiter,
+				Block: l.BlockNumber, Detail: fmt.Sprintf("revealed %d blocks after commit", l.BlockNumber-r.CommitBlock)})
+		}
+	}
+	return nil
+}
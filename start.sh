@@ -1,2 +1,5 @@
 #!/bin/bash
-nohup ./robot > d.log 2>&1 &
\ No newline at end of file
+# the robot writes and rotates its own log to logFile of conf/app.conf,
+# only output the log can't catch, like a panic, ends up in crash.log.
+mkdir -p logs
+nohup ./robot >> logs/crash.log 2>&1 &
@@ -4,7 +4,8 @@ import (
 	"errors"
 	"fmt"
 	jwt "github.com/dgrijalva/jwt-go"
-	"log"
+	"github.com/hpb-project/srng-robot/log"
+	"strings"
 	"time"
 )
 
@@ -16,13 +17,50 @@ type JwtClaims struct {
 }
 
 var (
-	key    []byte = []byte("7b21ff514564ea1be967ff7433485b00")
-	issuer string = "ipcloud-api"
+	key    []byte
+	issuer string = "srng-robot"
 )
 
+const (
+	RoleRead     = "ROLE_READ"
+	RoleOperator = "ROLE_OPERATOR"
+)
+
+//设置签名密钥
+func SetJwtSecret(secret string) {
+	key = []byte(secret)
+}
+
+//令牌是否可用
+func JwtEnabled() bool {
+	return len(key) > 0
+}
+
+//检查令牌是否包含角色
+func (c *JwtClaims) HasRole(role string) bool {
+	for _, r := range strings.Split(c.Authorities, ",") {
+		if strings.TrimSpace(r) == role {
+			return true
+		}
+	}
+	return false
+}
+
+func keyFunc(t *jwt.Token) (interface{}, error) {
+	if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+	}
+	if len(key) == 0 {
+		return nil, errors.New("jwt secret not set")
+	}
+	return key, nil
+}
+
 //生成token令牌
-func CreateToken(userId, apiId string, expireTime int64) (string, error) {
-	fmt.Println(time.Now().Unix())
+func CreateToken(userId, apiId, authorities string, expireTime int64) (string, error) {
+	if len(key) == 0 {
+		return "", errors.New("jwt secret not set")
+	}
 	claims := JwtClaims{
 		&jwt.StandardClaims{
 			IssuedAt:  	time.Now().Unix(),
@@ -34,13 +72,13 @@ func CreateToken(userId, apiId string, expireTime int64) (string, error) {
 		},
 		apiId,
 		userId,
-		"ROLE_ADMIN,AUTH_WRITE,ACTUATOR",
+		authorities,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	ss, err := token.SignedString(key)
 	if err != nil {
-		log.Printf("parse date err： %v", err)
+		log.Warn("sign jwt failed", "err", err)
 		return "", errors.New("生成Token异常，请检查参数")
 	}
 	return ss, nil
@@ -57,14 +95,14 @@ func DestoryToken() string {
 		},
 		issuer,
 		"exit",
-		"ROLE_ADMIN,AUTH_WRITE,ACTUATOR",
+		"",
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	ss, err := token.SignedString(key)
 	if err != nil {
 		// log.Error(err)
-		log.Printf("parse date err： %v", err)
+		log.Warn("parse jwt failed", "err", err)
 		return ""
 	}
 	return ss
@@ -72,24 +110,26 @@ func DestoryToken() string {
 
 //检查token
 func CheckToken(token string) bool {
-	_, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) {
-		return key, nil
-	})
+	var jclaim = &JwtClaims{StandardClaims: &jwt.StandardClaims{}}
+	_, err := jwt.ParseWithClaims(token, jclaim, keyFunc)
 	if err != nil {
-		fmt.Println("parase with claims failed.", err)
+		log.Warn("parse jwt failed", "err", err)
 		return false
 	}
-	return true
+	return jclaim.VerifyIssuer(issuer, true)
 }
 
 //解析jwt
 func ParseJwt(token string) (*JwtClaims, error) {
-	var jclaim = &JwtClaims{}
-	_, err := jwt.ParseWithClaims(token, jclaim, func(*jwt.Token) (interface{}, error) {
-		return key, nil
-	})
+	var jclaim = &JwtClaims{StandardClaims: &jwt.StandardClaims{}}
+	_, err := jwt.ParseWithClaims(token, jclaim, keyFunc)
 	if err != nil {
-		fmt.Println("parase with claims failed.", err, token)
+		log.Warn("parse jwt failed", "err", err)
+		return nil, errors.New("parase with claims failed.")
+	}
+	// a token signed with the same secret by another service is no token of ours.
+	if !jclaim.VerifyIssuer(issuer, true) {
+		log.Warn("parse jwt failed", "err", "unexpected issuer", "issuer", jclaim.Issuer)
 		return nil, errors.New("parase with claims failed.")
 	}
 	return jclaim, nil